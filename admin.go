@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"net/http"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	adminPath        = []byte("/admin/")
+	adminLinksPath   = []byte("/admin/links/")
+	adminMetricsPath = []byte("/admin/metrics")
+
+	bearerAuthPrefix = []byte("Bearer ")
+)
+
+type adminUpdateLinkRequest struct {
+	Url string `json:"url"`
+
+	// ExpectedUrl is optional. If set - link will be updated only if current url is equal to it.
+	ExpectedUrl string `json:"expected_url,omitempty"`
+}
+
+// handleAdminRequest route requests to admin endpoints:
+// GET|HEAD /admin/links/{id} - 204 if link exists, 404 otherwise
+// PUT /admin/links/{id} - change destination of link, body is adminUpdateLinkRequest
+// DELETE /admin/links/{id} - delete link
+// GET /admin/metrics - all expvar variables as json object
+func handleAdminRequest(ctx *fasthttp.RequestCtx) {
+	if err := checkAdminAuth(ctx); err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+
+	path := ctx.Path()
+	if bytes.Equal(path, adminMetricsPath) {
+		if !ctx.IsGet() && !ctx.IsHead() {
+			ctx.Response.Header.Set("Allow", "GET, HEAD")
+			writeApiError(ctx, httpErrMethodNotAllowed)
+			return
+		}
+		handleAdminMetrics(ctx)
+		return
+	}
+	if !bytes.HasPrefix(path, adminLinksPath) {
+		writeApiError(ctx, httpErrRouteNotFound)
+		return
+	}
+
+	mutableStorage, ok := storage.(MutableStorage)
+	if !ok {
+		writeApiError(ctx, httpErrNotSupported)
+		return
+	}
+
+	id, err := decodeLinkId(path[len(adminLinksPath):])
+	if err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+
+	switch {
+	case ctx.IsGet() || ctx.IsHead():
+		handleAdminLinkExists(ctx, mutableStorage, id)
+	case ctx.IsPut():
+		handleAdminUpdateLink(ctx, mutableStorage, id)
+	case ctx.IsDelete():
+		handleAdminDeleteLink(ctx, mutableStorage, id)
+	default:
+		ctx.Response.Header.Set("Allow", "GET, HEAD, PUT, DELETE")
+		writeApiError(ctx, httpErrMethodNotAllowed)
+	}
+}
+
+func checkAdminAuth(ctx *fasthttp.RequestCtx) error {
+	if *adminToken == "" {
+		return httpErrForbidden
+	}
+
+	auth := ctx.Request.Header.Peek("Authorization")
+	if !bytes.HasPrefix(auth, bearerAuthPrefix) ||
+		subtle.ConstantTimeCompare(auth[len(bearerAuthPrefix):], []byte(*adminToken)) != 1 {
+		ctx.Response.Header.Set("WWW-Authenticate", "Bearer")
+		return httpErrUnauthorized
+	}
+	return nil
+}
+
+func handleAdminLinkExists(ctx *fasthttp.RequestCtx, s MutableStorage, id []byte) {
+	exists, err := s.Exists(id)
+	if err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+	if !exists {
+		writeApiError(ctx, httpErrNotFound)
+		return
+	}
+	ctx.SetStatusCode(http.StatusNoContent)
+}
+
+func handleAdminDeleteLink(ctx *fasthttp.RequestCtx, s MutableStorage, id []byte) {
+	if err := s.Delete(id); err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+	ctx.SetStatusCode(http.StatusNoContent)
+}
+
+func handleAdminUpdateLink(ctx *fasthttp.RequestCtx, s MutableStorage, id []byte) {
+	var req adminUpdateLinkRequest
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		writeApiError(ctx, httpErrBadRequest.withErr(err))
+		return
+	}
+	newUrl, err := prepareUrl([]byte(req.Url), id)
+	if err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+
+	oldValue, err := s.Get(id)
+	if err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+	record, err := unmarshalLinkRecord(oldValue)
+	if err != nil {
+		writeApiError(ctx, httpErrInternal.withErr(err))
+		return
+	}
+	if req.ExpectedUrl != "" && req.ExpectedUrl != string(record.Url) {
+		writeApiError(ctx, httpErrConflict.withErr(errValueMismatch))
+		return
+	}
+
+	record.Url = newUrl
+	if err = s.Update(id, oldValue, record.Marshal()); err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+	writeApiJson(ctx, http.StatusOK, newApiLink(id, record))
+}
+
+// handleAdminMetrics write expvar variables in same format as expvar handler of net/http.
+func handleAdminMetrics(ctx *fasthttp.RequestCtx) {
+	vars := make(map[string]json.RawMessage)
+	expvar.Do(func(kv expvar.KeyValue) {
+		vars[kv.Key] = json.RawMessage(kv.Value.String())
+	})
+	writeApiJson(ctx, http.StatusOK, vars)
+}
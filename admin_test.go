@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+const testAdminToken = "test-admin-token"
+
+//nolint:deadcode,megacheck
+func handlerTestAdminRequest(method, uri, token string, body []byte) *fasthttp.RequestCtx {
+	var req fasthttp.Request
+	req.Header.SetMethod(method)
+	req.SetRequestURI(uri)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.SetBody(body)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, nil, nil)
+	handleRequest(&ctx)
+	return &ctx
+}
+
+//nolint:deadcode,megacheck
+func TestAdmin_Auth(t *testing.T) {
+	handlerTestInit()
+	defer func() { *adminToken = "" }()
+
+	*adminToken = ""
+	ctx := handlerTestAdminRequest("DELETE", "/admin/links/AAAAAAAA", "", nil)
+	if ctx.Response.StatusCode() != http.StatusForbidden {
+		t.Error(ctx.Response.StatusCode())
+	}
+
+	*adminToken = testAdminToken
+	for _, token := range []string{"", "wrong"} {
+		ctx = handlerTestAdminRequest("DELETE", "/admin/links/AAAAAAAA", token, nil)
+		if ctx.Response.StatusCode() != http.StatusUnauthorized {
+			t.Error(token, ctx.Response.StatusCode())
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestAdmin_Links(t *testing.T) {
+	handlerTestInit()
+	defer func() { *adminToken = "" }()
+	*adminToken = testAdminToken
+
+	id := handlerTestStore(t, "http://example.com/typo")
+	adminUrl := "/admin/links/" + id
+
+	ctx := handlerTestAdminRequest("HEAD", adminUrl, testAdminToken, nil)
+	if ctx.Response.StatusCode() != http.StatusNoContent {
+		t.Error(ctx.Response.StatusCode())
+	}
+
+	ctx = handlerTestAdminRequest("PUT", adminUrl, testAdminToken,
+		[]byte(`{"url":"http://example.com/fixed","expected_url":"http://example.com/wrong"}`))
+	if ctx.Response.StatusCode() != http.StatusConflict {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	ctx = handlerTestAdminRequest("PUT", adminUrl, testAdminToken, []byte(`{"url":"bad-url"}`))
+	if ctx.Response.StatusCode() != http.StatusBadRequest {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	ctx = handlerTestAdminRequest("PUT", adminUrl, testAdminToken,
+		[]byte(`{"url":"http://example.com/fixed","expected_url":"http://example.com/typo"}`))
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	ctx = handlerTestRequest("GET", "/"+id)
+	if location := string(ctx.Response.Header.Peek("Location")); location != "http://example.com/fixed" {
+		t.Error(location)
+	}
+
+	ctx = handlerTestAdminRequest("DELETE", adminUrl, testAdminToken, nil)
+	if ctx.Response.StatusCode() != http.StatusNoContent {
+		t.Error(ctx.Response.StatusCode())
+	}
+
+	ctx = handlerTestRequest("GET", "/"+id)
+	if ctx.Response.StatusCode() != http.StatusNotFound {
+		t.Error(ctx.Response.StatusCode())
+	}
+
+	for _, method := range []string{"GET", "DELETE"} {
+		ctx = handlerTestAdminRequest(method, adminUrl, testAdminToken, nil)
+		if ctx.Response.StatusCode() != http.StatusNotFound {
+			t.Error(method, ctx.Response.StatusCode())
+		}
+	}
+	ctx = handlerTestAdminRequest("PUT", adminUrl, testAdminToken, []byte(`{"url":"http://example.com/fixed"}`))
+	if ctx.Response.StatusCode() != http.StatusNotFound {
+		t.Error(ctx.Response.StatusCode())
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestAdmin_NotSupported(t *testing.T) {
+	handlerTestInit()
+	defer func() { *adminToken = "" }()
+	*adminToken = testAdminToken
+	storage = storageFailing{}
+
+	ctx := handlerTestAdminRequest("DELETE", "/admin/links/AAAAAAAA", testAdminToken, nil)
+	if ctx.Response.StatusCode() != http.StatusNotImplemented {
+		t.Error(ctx.Response.StatusCode())
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestAdmin_Metrics(t *testing.T) {
+	handlerTestInit()
+	defer func() { *adminToken = "" }()
+	*adminToken = testAdminToken
+
+	ctx := handlerTestAdminRequest("GET", "/admin/metrics", testAdminToken, nil)
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Error(ctx.Response.StatusCode())
+	}
+	var vars map[string]interface{}
+	if err := json.Unmarshal(ctx.Response.Body(), &vars); err != nil || vars["memstats"] == nil {
+		t.Error(err, string(ctx.Response.Body()))
+	}
+
+	storage = NewStorageCache(storageFailing{}, 10, 1000, 0)
+	ctx = handlerTestAdminRequest("DELETE", "/admin/links/AAAAAAAA", testAdminToken, nil)
+	if ctx.Response.StatusCode() != http.StatusNotImplemented {
+		t.Error(ctx.Response.StatusCode())
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	aliasMinLen = 3
+	aliasMaxLen = 64
+)
+
+// aliasKeyPrefix separate aliases from generated ids in storage. Generated ids have fixed length idLength,
+// aliases with key of the same length are forbidden so keys can't collide.
+var aliasKeyPrefix = []byte("alias/")
+
+var aliasReservedWords = map[string]bool{
+	"admin":  true,
+	"api":    true,
+	"batch":  true,
+	"debug":  true,
+	"health": true,
+	"links":  true,
+	"static": true,
+}
+
+var (
+	errAliasLength   = fmt.Errorf("Alias length must be from %v to %v", aliasMinLen, aliasMaxLen)
+	errAliasAlphabet = errors.New("Alias may contain only latin letters, digits, '-' and '_'")
+	errAliasReserved = errors.New("Alias is reserved")
+	errAliasIdLength = errors.New("Alias can't have same length as generated id")
+
+	errAliasCheckedIdLength = errors.New("Alias can't be one symbol shorter or longer than generated id with check character")
+)
+
+// checkAlias validate custom short link name
+func checkAlias(alias []byte) error {
+	if len(alias) < aliasMinLen || len(alias) > aliasMaxLen {
+		return errAliasLength
+	}
+	for _, c := range alias {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return errAliasAlphabet
+		}
+	}
+	if aliasReservedWords[strings.ToLower(string(alias))] {
+		return errAliasReserved
+	}
+	if isEncodedIdLen(len(alias)) || len(aliasKeyPrefix)+len(alias) == idLength {
+		return errAliasIdLength
+	}
+	if isMistypedIdLen(len(alias)) {
+		return errAliasCheckedIdLength
+	}
+	return nil
+}
+
+func aliasKey(alias []byte) []byte {
+	res := make([]byte, len(aliasKeyPrefix)+len(alias))
+	copy(res, aliasKeyPrefix)
+	copy(res[len(aliasKeyPrefix):], alias)
+	return res
+}
+
+func isAliasKey(key []byte) bool {
+	return len(key) != idLength && bytes.HasPrefix(key, aliasKeyPrefix)
+}
+
+// isEncodedIdLen return true if encoded generated id has the length
+func isEncodedIdLen(encodedLen int) bool {
+	return encodedLen == len(idEncoding.Encode(nil, make([]byte, idLength)))
+}
+
+// makeLinkUrl make short url for storage key of link: encoded id for generated ids and the alias as is for aliases.
+func makeLinkUrl(prefix, key []byte) []byte {
+	if !isAliasKey(key) {
+		return idEncoding.Encode(prefix, key)
+	}
+	alias := key[len(aliasKeyPrefix):]
+	res := make([]byte, len(prefix)+len(alias))
+	copy(res, prefix)
+	copy(res[len(prefix):], alias)
+	return res
+}
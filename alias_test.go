@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+//nolint:deadcode,megacheck
+func TestCheckAlias(t *testing.T) {
+	table := []struct {
+		alias string
+		err   error
+	}{
+		{"spring-sale", nil},
+		{"Spring_Sale_2018", nil},
+		{"abc", nil},
+		{"ab", errAliasLength},
+		{"a123456789a123456789a123456789a123456789a123456789a123456789a1234", errAliasLength},
+		{"spring sale", errAliasAlphabet},
+		{"spring/sale", errAliasAlphabet},
+		{"распродажа", errAliasAlphabet},
+		{"api", errAliasReserved},
+		{"Admin", errAliasReserved},
+		{"abcdefgh", errAliasIdLength}, // same length as base64 encoded 6 bytes id
+	}
+
+	for _, test := range table {
+		if err := checkAlias([]byte(test.alias)); err != test.err {
+			t.Error(test.alias, err)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestMakeLinkUrl(t *testing.T) {
+	if res := string(makeLinkUrl([]byte("http://sho.rt/"), aliasKey([]byte("spring-sale")))); res != "http://sho.rt/spring-sale" {
+		t.Error(res)
+	}
+
+	id := []byte{1, 2, 3, 4, 5, 6}
+	if res := string(makeLinkUrl([]byte("http://sho.rt/"), id)); res != string(idEncoding.Encode([]byte("http://sho.rt/"), id)) {
+		t.Error(res)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestHandleRequest_Alias(t *testing.T) {
+	handlerTestInit()
+
+	ctx := handlerTestRequest("GET", "/?url=http://example.com/sale&alias=spring-sale")
+	if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != "http://sho.rt/spring-sale" {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	ctx = handlerTestRequest("GET", "/spring-sale")
+	if ctx.Response.StatusCode() != http.StatusFound ||
+		string(ctx.Response.Header.Peek("Location")) != "http://example.com/sale" {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Header.Peek("Location")))
+	}
+
+	ctx = handlerTestRequest("GET", "/?url=http://example.com/other&alias=spring-sale")
+	if ctx.Response.StatusCode() != http.StatusConflict ||
+		string(ctx.Response.Header.Peek("X-Error-Code")) != "alias_taken" {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	ctx = handlerTestRequest("GET", "/?url=http://example.com/other&alias=api")
+	if ctx.Response.StatusCode() != http.StatusBadRequest ||
+		string(ctx.Response.Header.Peek("X-Error-Code")) != "bad_alias" {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	ctx = handlerTestRequest("GET", "/unknown-alias")
+	if ctx.Response.StatusCode() != http.StatusNotFound {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestApiCreateLink_Alias(t *testing.T) {
+	handlerTestInit()
+
+	ctx := handlerTestRequestBody("POST", "/api/v1/links", []byte(`{"url":"http://example.com/sale","alias":"Spring_Sale"}`))
+	if ctx.Response.StatusCode() != http.StatusCreated {
+		t.Fatal(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	ctx = handlerTestRequest("GET", "/api/v1/links/Spring_Sale")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatal(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+	expectedBody := `"id":"Spring_Sale","short_url":"http://sho.rt/Spring_Sale","long_url":"http://example.com/sale"`
+	if body := string(ctx.Response.Body()); !strings.Contains(body, expectedBody) {
+		t.Error(body)
+	}
+
+	ctx = handlerTestRequestBody("POST", "/api/v1/links", []byte(`{"url":"http://example.com/sale","alias":"Spring_Sale"}`))
+	if ctx.Response.StatusCode() != http.StatusConflict {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+}
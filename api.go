@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	apiLinksPath      = []byte("/api/v1/links")
+	apiLinksBatchPath = []byte("/batch")
+	apiLinkStatsPath  = []byte("/stats")
+)
+
+type apiCreateLinkRequest struct {
+	Url   string `json:"url"`
+	Alias string `json:"alias,omitempty"`
+
+	// ExpiresAt in RFC3339 format, ExpiresIn in time.ParseDuration format. Only one of them may be set.
+	ExpiresAt string `json:"expires_at,omitempty"`
+	ExpiresIn string `json:"expires_in,omitempty"`
+}
+
+type apiLink struct {
+	Id        string     `json:"id"`
+	ShortUrl  string     `json:"short_url"`
+	LongUrl   string     `json:"long_url"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func newApiLink(id []byte, record linkRecord) apiLink {
+	res := apiLink{
+		Id:       string(makeLinkUrl(nil, id)),
+		ShortUrl: string(makeLinkUrl(urlPrefixBytes, id)),
+		LongUrl:  string(record.Url),
+	}
+	if !record.CreatedAt.IsZero() {
+		createdAt := record.CreatedAt
+		res.CreatedAt = &createdAt
+	}
+	if !record.ExpiresAt.IsZero() {
+		expiresAt := record.ExpiresAt
+		res.ExpiresAt = &expiresAt
+	}
+	return res
+}
+
+// handleApiLinksRequest route requests:
+// POST /api/v1/links - create link
+// POST /api/v1/links/batch - create many links
+// GET /api/v1/links/{id} - link metadata
+// GET /api/v1/links/{id}/stats - link click stats
+func handleApiLinksRequest(ctx *fasthttp.RequestCtx) {
+	path := ctx.Path()[len(apiLinksPath):]
+	switch {
+	case bytes.Equal(path, apiLinksBatchPath):
+		if !ctx.IsPost() {
+			ctx.Response.Header.Set("Allow", "POST")
+			writeApiError(ctx, httpErrMethodNotAllowed)
+			return
+		}
+		handleApiCreateLinks(ctx)
+	case len(path) == 0 || len(path) == 1 && path[0] == '/':
+		if !ctx.IsPost() {
+			ctx.Response.Header.Set("Allow", "POST")
+			writeApiError(ctx, httpErrMethodNotAllowed)
+			return
+		}
+		handleApiCreateLink(ctx)
+	case path[0] == '/':
+		if !ctx.IsGet() && !ctx.IsHead() {
+			ctx.Response.Header.Set("Allow", "GET, HEAD")
+			writeApiError(ctx, httpErrMethodNotAllowed)
+			return
+		}
+		if bytes.HasSuffix(path, apiLinkStatsPath) {
+			// "/stats" and "//stats" have no id
+			if len(path) <= len(apiLinkStatsPath)+1 {
+				writeApiError(ctx, httpErrRouteNotFound)
+				return
+			}
+			handleApiGetLinkStats(ctx, path[1:len(path)-len(apiLinkStatsPath)])
+			return
+		}
+		handleApiGetLink(ctx, path[1:])
+	default:
+		writeApiError(ctx, httpErrRouteNotFound)
+	}
+}
+
+func handleApiCreateLink(ctx *fasthttp.RequestCtx) {
+	var req apiCreateLinkRequest
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		writeApiError(ctx, httpErrBadRequest.withErr(err))
+		return
+	}
+
+	expiresAt, err := parseLinkExpiration(req.ExpiresAt, req.ExpiresIn)
+	if err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+	opts := linkOptions{
+		Alias:     []byte(req.Alias),
+		ExpiresAt: expiresAt,
+	}
+
+	id, record, err := createLink([]byte(req.Url), opts)
+	if err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+
+	link := newApiLink(id, record)
+	ctx.Response.Header.Set("Location", string(apiLinksPath)+"/"+link.Id)
+	writeApiJson(ctx, http.StatusCreated, link)
+}
+
+type apiBatchResult struct {
+	Link  *apiLink  `json:"link,omitempty"`
+	Error *apiError `json:"error,omitempty"`
+}
+
+type apiBatchResponse struct {
+	Results []apiBatchResult `json:"results"`
+}
+
+// handleApiCreateLinks accept json array of urls or text with url on every line.
+// Results are returned in same order as urls in request.
+func handleApiCreateLinks(ctx *fasthttp.RequestCtx) {
+	urls, err := parseBatchUrls(ctx.PostBody())
+	if err != nil {
+		writeApiError(ctx, httpErrBadRequest.withErr(err))
+		return
+	}
+	if len(urls) > *maxBatchSize {
+		writeApiError(ctx, httpErrBadRequest.withErr(fmt.Errorf("Too many urls in batch: %v, max: %v",
+			len(urls), *maxBatchSize)))
+		return
+	}
+
+	results := createLinks(urls)
+	resp := apiBatchResponse{Results: make([]apiBatchResult, len(results))}
+	for i, res := range results {
+		if res.Err != nil {
+			apiErr := newApiError(toHttpError(res.Err))
+			resp.Results[i].Error = &apiErr
+			continue
+		}
+		link := newApiLink(res.Id, res.Record)
+		resp.Results[i].Link = &link
+	}
+	writeApiJson(ctx, http.StatusOK, resp)
+}
+
+func parseBatchUrls(body []byte) ([][]byte, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var urls []string
+		if err := json.Unmarshal(body, &urls); err != nil {
+			return nil, err
+		}
+		res := make([][]byte, len(urls))
+		for i := range urls {
+			res[i] = []byte(urls[i])
+		}
+		return res, nil
+	}
+
+	var res [][]byte
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			res = append(res, line)
+		}
+	}
+	return res, nil
+}
+
+func handleApiGetLink(ctx *fasthttp.RequestCtx, encodedId []byte) {
+	id, record, err := findLink(encodedId)
+	if err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+	writeApiJson(ctx, http.StatusOK, newApiLink(id, record))
+}
+
+type apiLinkStats struct {
+	Clicks      int64      `json:"clicks"`
+	FirstAccess *time.Time `json:"first_access,omitempty"`
+	LastAccess  *time.Time `json:"last_access,omitempty"`
+}
+
+func handleApiGetLinkStats(ctx *fasthttp.RequestCtx, encodedId []byte) {
+	if clicks == nil {
+		writeApiError(ctx, httpErrNotSupported)
+		return
+	}
+
+	id, _, err := findLink(encodedId)
+	if err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+	stats, err := clicks.Get(id)
+	if err != nil {
+		writeApiError(ctx, err)
+		return
+	}
+
+	res := apiLinkStats{Clicks: stats.Count}
+	if stats.Count > 0 {
+		res.FirstAccess = &stats.FirstAccess
+		res.LastAccess = &stats.LastAccess
+	}
+	writeApiJson(ctx, http.StatusOK, res)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+//nolint:deadcode,megacheck
+func TestApiCreateLink(t *testing.T) {
+	handlerTestInit()
+	ctx := handlerTestRequestBody("POST", "/api/v1/links", []byte(`{"url":"http://example.com/page"}`))
+	if ctx.Response.StatusCode() != http.StatusCreated {
+		t.Fatal(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+	if contentType := string(ctx.Response.Header.ContentType()); contentType != "application/json" {
+		t.Error(contentType)
+	}
+
+	var link apiLink
+	if err := json.Unmarshal(ctx.Response.Body(), &link); err != nil {
+		t.Fatal(err)
+	}
+	if link.Id == "" || link.ShortUrl != "http://sho.rt/"+link.Id || link.LongUrl != "http://example.com/page" ||
+		link.CreatedAt == nil || link.CreatedAt.IsZero() {
+		t.Error(string(ctx.Response.Body()))
+	}
+	if location := string(ctx.Response.Header.Peek("Location")); location != "/api/v1/links/"+link.Id {
+		t.Error(location)
+	}
+
+	ctx = handlerTestRequest("GET", "/api/v1/links/"+link.Id)
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatal(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+	var loaded apiLink
+	if err := json.Unmarshal(ctx.Response.Body(), &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Id != link.Id || loaded.ShortUrl != link.ShortUrl || loaded.LongUrl != link.LongUrl ||
+		!loaded.CreatedAt.Equal(*link.CreatedAt) {
+		t.Error(string(ctx.Response.Body()))
+	}
+
+	// compatibility redirect work for links, created by api
+	ctx = handlerTestRequest("GET", "/"+link.Id)
+	if ctx.Response.StatusCode() != http.StatusFound ||
+		string(ctx.Response.Header.Peek("Location")) != "http://example.com/page" {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Header.Peek("Location")))
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestApiErrors(t *testing.T) {
+	handlerTestInit()
+
+	table := []struct {
+		method string
+		uri    string
+		body   string
+		status int
+		code   string
+	}{
+		{"POST", "/api/v1/links", `{"url":`, http.StatusBadRequest, "bad_request"},
+		{"POST", "/api/v1/links", `{"url":"bad-url"}`, http.StatusBadRequest, "bad_url"},
+		{"GET", "/api/v1/links", ``, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"DELETE", "/api/v1/links/AAAAAAAA", ``, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"GET", "/api/v1/linksX", ``, http.StatusNotFound, "route_not_found"},
+		{"GET", "/api/v1/links/$$$", ``, http.StatusBadRequest, "bad_id"},
+		{"GET", "/api/v1/links/AAAAAAAA", ``, http.StatusNotFound, "not_found"},
+	}
+
+	for _, test := range table {
+		ctx := handlerTestRequestBody(test.method, test.uri, []byte(test.body))
+		if ctx.Response.StatusCode() != test.status {
+			t.Error(test.method, test.uri, ctx.Response.StatusCode())
+		}
+		var resp apiErrorResponse
+		if err := json.Unmarshal(ctx.Response.Body(), &resp); err != nil {
+			t.Error(test.method, test.uri, err)
+		}
+		if resp.Error.Code != test.code || string(ctx.Response.Header.Peek("X-Error-Code")) != test.code {
+			t.Error(test.method, test.uri, string(ctx.Response.Body()))
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestApiCreateLinks(t *testing.T) {
+	bodies := []string{
+		`["http://example.com/1", "bad-url", "http://example.com/3"]`,
+		"http://example.com/1\r\nbad-url\n\n  http://example.com/3\n",
+	}
+
+	for _, body := range bodies {
+		handlerTestInit()
+		ctx := handlerTestRequestBody("POST", "/api/v1/links/batch", []byte(body))
+		if ctx.Response.StatusCode() != http.StatusOK {
+			t.Fatal(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+		}
+
+		var resp apiBatchResponse
+		if err := json.Unmarshal(ctx.Response.Body(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Results) != 3 {
+			t.Fatal(string(ctx.Response.Body()))
+		}
+		if resp.Results[0].Link == nil || resp.Results[0].Link.LongUrl != "http://example.com/1" ||
+			resp.Results[0].Error != nil {
+			t.Error(string(ctx.Response.Body()))
+		}
+		if resp.Results[1].Link != nil || resp.Results[1].Error == nil || resp.Results[1].Error.Code != "bad_url" {
+			t.Error(string(ctx.Response.Body()))
+		}
+		if resp.Results[2].Link == nil || resp.Results[2].Link.LongUrl != "http://example.com/3" ||
+			resp.Results[2].Error != nil {
+			t.Error(string(ctx.Response.Body()))
+		}
+
+		for _, index := range []int{0, 2} {
+			link := resp.Results[index].Link
+			ctx = handlerTestRequest("GET", "/"+link.Id)
+			if string(ctx.Response.Header.Peek("Location")) != link.LongUrl {
+				t.Error(link.Id, string(ctx.Response.Header.Peek("Location")))
+			}
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestApiCreateLinks_TooMany(t *testing.T) {
+	handlerTestInit()
+	oldMaxBatchSize := *maxBatchSize
+	defer func() { *maxBatchSize = oldMaxBatchSize }()
+	*maxBatchSize = 1
+
+	ctx := handlerTestRequestBody("POST", "/api/v1/links/batch", []byte(`["http://example.com/1", "http://example.com/2"]`))
+	if ctx.Response.StatusCode() != http.StatusBadRequest {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestApiGetLinkStats(t *testing.T) {
+	handlerTestInit()
+	ctx := handlerTestRequest("GET", "/api/v1/links/AAAAAAAA/stats")
+	if ctx.Response.StatusCode() != http.StatusNotImplemented {
+		t.Error(ctx.Response.StatusCode())
+	}
+
+	clicks = newClickCounter(storage.(ClickStorage))
+
+	id := handlerTestStore(t, "http://example.com/page")
+	ctx = handlerTestRequest("GET", "/api/v1/links/"+id+"/stats")
+	if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != `{"clicks":0}` {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	for i := 0; i < 2; i++ {
+		handlerTestRequest("GET", "/"+id)
+	}
+	handlerTestRequest("GET", "/"+id+"?plain")
+	if err := clicks.Flush(); err != nil {
+		t.Error(err)
+	}
+	handlerTestRequest("GET", "/"+id)
+
+	ctx = handlerTestRequest("GET", "/api/v1/links/"+id+"/stats")
+	var stats apiLinkStats
+	if err := json.Unmarshal(ctx.Response.Body(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Clicks != 4 || stats.FirstAccess == nil || stats.LastAccess == nil || stats.LastAccess.Before(*stats.FirstAccess) {
+		t.Error(string(ctx.Response.Body()))
+	}
+
+	ctx = handlerTestRequest("GET", "/api/v1/links/AAAAAAAA/stats")
+	if ctx.Response.StatusCode() != http.StatusNotFound {
+		t.Error(ctx.Response.StatusCode())
+	}
+
+	// stats path without id
+	for _, uri := range []string{"/api/v1/links/stats", "/api/v1/links//stats"} {
+		ctx = handlerTestRequest("GET", uri)
+		if ctx.Response.StatusCode() != http.StatusNotFound ||
+			string(ctx.Response.Header.Peek("X-Error-Code")) != "route_not_found" {
+			t.Error(uri, ctx.Response.StatusCode(), string(ctx.Response.Body()))
+		}
+	}
+}
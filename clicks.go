@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// clickCounter buffer clicks in memory and flush them to storage periodically,
+// so counting doesn't add storage request to redirect.
+type clickCounter struct {
+	storage ClickStorage
+
+	mutex   sync.Mutex
+	pending map[string]ClickStats
+}
+
+func newClickCounter(s ClickStorage) *clickCounter {
+	return &clickCounter{
+		storage: s,
+		pending: make(map[string]ClickStats),
+	}
+}
+
+// Hit count one click of link
+func (c *clickCounter) Hit(key []byte, now time.Time) {
+	c.mutex.Lock()
+	stats := c.pending[string(key)]
+	stats.Add(ClickStats{Count: 1, FirstAccess: now, LastAccess: now})
+	c.pending[string(key)] = stats
+	c.mutex.Unlock()
+}
+
+// Get return stats from storage with clicks, which are not flushed yet.
+func (c *clickCounter) Get(key []byte) (ClickStats, error) {
+	stats, err := c.storage.GetClicks(key)
+	if err != nil {
+		return ClickStats{}, err
+	}
+
+	c.mutex.Lock()
+	if pending, ok := c.pending[string(key)]; ok {
+		stats.Add(pending)
+	}
+	c.mutex.Unlock()
+	return stats, nil
+}
+
+// Flush write buffered clicks to storage. Clicks which can't be written are kept for next flush.
+func (c *clickCounter) Flush() error {
+	c.mutex.Lock()
+	pending := c.pending
+	c.pending = make(map[string]ClickStats, len(pending))
+	c.mutex.Unlock()
+
+	var firstErr error
+	for key, stats := range pending {
+		err := c.storage.AddClicks([]byte(key), stats)
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		c.mutex.Lock()
+		restored := c.pending[key]
+		restored.Add(stats)
+		c.pending[key] = restored
+		c.mutex.Unlock()
+	}
+	return firstErr
+}
+
+// Run flush clicks every interval. It never returns.
+func (c *clickCounter) Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := c.Flush(); err != nil {
+			log.Printf("Can't flush clicks to storage: %v", err)
+		}
+	}
+}
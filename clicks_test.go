@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+//nolint:deadcode,megacheck
+func TestClickCounter(t *testing.T) {
+	s := NewStorageMap()
+	c := newClickCounter(s)
+	key := []byte("123")
+	if err := s.Store(key, []byte("http://example.com/")); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1500000000, 0).UTC()
+
+	for i := 0; i < 3; i++ {
+		c.Hit(key, start.Add(time.Duration(i)*time.Second))
+	}
+
+	if stats, _ := s.GetClicks(key); stats.Count != 0 {
+		t.Error("Clicks saved before flush", stats)
+	}
+	stats, err := c.Get(key)
+	if err != nil || stats.Count != 3 || !stats.FirstAccess.Equal(start) || !stats.LastAccess.Equal(start.Add(2*time.Second)) {
+		t.Error(err, stats)
+	}
+
+	if err = c.Flush(); err != nil {
+		t.Error(err)
+	}
+	c.Hit(key, start.Add(time.Minute))
+	if err = c.Flush(); err != nil {
+		t.Error(err)
+	}
+
+	stats, err = s.GetClicks(key)
+	if err != nil || stats.Count != 4 || !stats.FirstAccess.Equal(start) || !stats.LastAccess.Equal(start.Add(time.Minute)) {
+		t.Error(err, stats)
+	}
+	if stats, err = c.Get(key); err != nil || stats.Count != 4 {
+		t.Error(err, stats)
+	}
+}
+
+type clickStorageFailing struct {
+	*StorageMap
+	fail bool
+}
+
+func (s *clickStorageFailing) AddClicks(key []byte, stats ClickStats) error {
+	if s.fail {
+		return errors.New("test backend failure")
+	}
+	return s.StorageMap.AddClicks(key, stats)
+}
+
+//nolint:deadcode,megacheck
+func TestClickCounter_FlushError(t *testing.T) {
+	s := &clickStorageFailing{StorageMap: NewStorageMap(), fail: true}
+	c := newClickCounter(s)
+	key := []byte("123")
+	if err := s.Store(key, []byte("http://example.com/")); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Hit(key, time.Now())
+	if err := c.Flush(); err == nil {
+		t.Error("Flush must return error")
+	}
+	c.Hit(key, time.Now())
+
+	s.fail = false
+	if err := c.Flush(); err != nil {
+		t.Error(err)
+	}
+	if stats, _ := s.GetClicks(key); stats.Count != 2 {
+		t.Error(stats)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestClickStats_Add(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	var stats ClickStats
+	stats.Add(ClickStats{Count: 2, FirstAccess: start.Add(time.Second), LastAccess: start.Add(2 * time.Second)})
+	stats.Add(ClickStats{Count: 1, FirstAccess: start, LastAccess: start.Add(time.Second)})
+	if stats.Count != 3 || !stats.FirstAccess.Equal(start) || !stats.LastAccess.Equal(start.Add(2*time.Second)) {
+		t.Error(stats)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	dchest "github.com/dchest/siphash"
+)
+
+// counterKey is key of counter of counter generator in storages, which implement CounterStorage.
+var counterKey = []byte("counter/ids")
+
+// CounterStorage is optional interface for backends, which can allocate numbers for all instances, connected
+// to the backend. LeaseCounter increase counter by n and return first number of leased block [first, first+n).
+// Blocks of different calls never intersect. Numbers start from 0.
+type CounterStorage interface {
+	LeaseCounter(n uint64) (first uint64, err error)
+}
+
+// idCounterSource is source of numbers for counter generator. It is set in main from storage or from -counter-file.
+var idCounterSource CounterStorage
+
+// CounterFile keep counter in local file. It is for single instance only: other processes with same file
+// will lease same numbers.
+type CounterFile struct {
+	fileName string
+	mutex    sync.Mutex
+}
+
+func NewCounterFile(fileName string) *CounterFile {
+	if err := os.MkdirAll(filepath.Dir(fileName), DEFAULT_DIR_MODE); err != nil {
+		panic(err)
+	}
+	return &CounterFile{fileName: fileName}
+}
+
+// LeaseCounter save new value of counter to disk before return, so numbers are never leased twice after crash.
+func (c *CounterFile) LeaseCounter(n uint64) (uint64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var first uint64
+	content, err := ioutil.ReadFile(c.fileName)
+	switch {
+	case os.IsNotExist(err):
+		// first lease
+	case err != nil:
+		return 0, err
+	default:
+		first, err = strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Bad counter file '%v': %v", c.fileName, err)
+		}
+	}
+
+	end, carry := bits.Add64(first, n, 0)
+	if carry != 0 {
+		return 0, fmt.Errorf("Counter in file '%v' is overflowed", c.fileName)
+	}
+	if err = writeFileAtomic(c.fileName, []byte(strconv.FormatUint(end, 10)), true); err != nil {
+		return 0, err
+	}
+	return first, nil
+}
+
+// counterGenerator make ids from numbers of counter: big endian number, permuted if permutation isn't nil.
+// Numbers are leased from source by blocks, so source is called once per blockSize ids. Rest of block is lost
+// on restart.
+type counterGenerator struct {
+	source      CounterStorage
+	blockSize   uint64
+	length      int
+	permutation *feistelPermutation
+
+	mutex sync.Mutex
+	next  uint64
+	end   uint64
+}
+
+// newCounterHashFunc make counter generator by flags. Return nil if source of numbers isn't set.
+func newCounterHashFunc(length int) HashFunc {
+	if idCounterSource == nil {
+		return nil
+	}
+	g := &counterGenerator{
+		source:    idCounterSource,
+		blockSize: uint64(*counterBlockSize),
+		length:    length,
+	}
+	if *counterPermute {
+		key := sipHashKeys.Keys[sipHashKeys.ActiveId]
+		g.permutation = newFeistelPermutation(length*8, key)
+	}
+	return g.Generate
+}
+
+// Generate return id for next number of counter. Value is ignored. Return nil if number can't be leased
+// or doesn't fit to id length.
+func (g *counterGenerator) Generate([]byte) []byte {
+	number, err := g.nextNumber()
+	if err != nil {
+		log.Printf("Can't generate id by counter: %v", err)
+		return nil
+	}
+
+	if g.permutation != nil {
+		number = g.permutation.Permute(number)
+	}
+	res := make([]byte, 8)
+	binary.BigEndian.PutUint64(res, number)
+	return res[8-g.length:]
+}
+
+func (g *counterGenerator) nextNumber() (uint64, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.next >= g.end {
+		first, err := g.source.LeaseCounter(g.blockSize)
+		if err != nil {
+			return 0, err
+		}
+		g.next, g.end = first, first+g.blockSize
+	}
+	number := g.next
+	if g.length < 8 && number>>uint(g.length*8) != 0 {
+		return 0, fmt.Errorf("Counter %v doesn't fit to %v bytes", number, g.length)
+	}
+	g.next++
+	return number, nil
+}
+
+const feistelRounds = 4
+
+// feistelPermutation is reversible permutation of numbers with given count of bits: balanced Feistel network
+// with siphash as round function. Ids of new numbers depend on key: if key is changed they can be equal to
+// existed ids, store of such ids fail with errDuplicate and next number is used.
+type feistelPermutation struct {
+	halfBits uint
+	k0, k1   uint64
+}
+
+// newFeistelPermutation make permutation of numbers with bitsCount bits (even, up to 64) with 16 bytes key.
+func newFeistelPermutation(bitsCount int, key []byte) *feistelPermutation {
+	return &feistelPermutation{
+		halfBits: uint(bitsCount / 2),
+		k0:       binary.LittleEndian.Uint64(key),
+		k1:       binary.LittleEndian.Uint64(key[8:]),
+	}
+}
+
+func (p *feistelPermutation) Permute(number uint64) uint64 {
+	mask := uint64(1)<<p.halfBits - 1
+	left, right := number>>p.halfBits, number&mask
+	for round := 0; round < feistelRounds; round++ {
+		left, right = right, left^p.roundFunc(round, right)&mask
+	}
+	return left<<p.halfBits | right
+}
+
+// Inverse return number, which is permuted to given value.
+func (p *feistelPermutation) Inverse(permuted uint64) uint64 {
+	mask := uint64(1)<<p.halfBits - 1
+	left, right := permuted>>p.halfBits, permuted&mask
+	for round := feistelRounds - 1; round >= 0; round-- {
+		left, right = right^p.roundFunc(round, left)&mask, left
+	}
+	return left<<p.halfBits | right
+}
+
+func (p *feistelPermutation) roundFunc(round int, half uint64) uint64 {
+	var input [9]byte
+	input[0] = byte(round)
+	binary.BigEndian.PutUint64(input[1:], half)
+	return dchest.Hash(p.k0, p.k1, input[:])
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	_ CounterStorage = &CounterFile{}
+	_ CounterStorage = &StorageRedis{}
+	_ CounterStorage = &StorageTarantool{}
+)
+
+// testCounterStorage is counter in memory, it fail all leases if err isn't nil
+type testCounterStorage struct {
+	counter uint64
+	leases  int
+	err     error
+}
+
+func (c *testCounterStorage) LeaseCounter(n uint64) (uint64, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.leases++
+	first := c.counter
+	c.counter += n
+	return first, nil
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestCounterFile_LeaseCounter(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	fileName := filepath.Join(tmpDir, "sub", "counter")
+
+	c := NewCounterFile(fileName)
+	if first, err := c.LeaseCounter(10); err != nil || first != 0 {
+		t.Error(first, err)
+	}
+	if first, err := c.LeaseCounter(5); err != nil || first != 10 {
+		t.Error(first, err)
+	}
+
+	// counter is kept after restart
+	c = NewCounterFile(fileName)
+	if first, err := c.LeaseCounter(1); err != nil || first != 15 {
+		t.Error(first, err)
+	}
+
+	ioutil.WriteFile(fileName, []byte("bad"), DEFAULT_FILE_MODE)
+	if _, err := c.LeaseCounter(1); err == nil {
+		t.Error(err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestCounterGenerator_Blocks(t *testing.T) {
+	source := &testCounterStorage{}
+	g := &counterGenerator{source: source, blockSize: 3, length: 2}
+	for i := 0; i < 7; i++ {
+		if id := g.Generate(nil); !bytes.Equal(id, []byte{0, byte(i)}) {
+			t.Error(i, id)
+		}
+	}
+	if source.leases != 3 {
+		t.Error(source.leases)
+	}
+
+	source.err = errors.New("test")
+	g.Generate(nil)
+	g.Generate(nil)
+	if id := g.Generate(nil); id != nil {
+		t.Error(id)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestCounterGenerator_Overflow(t *testing.T) {
+	g := &counterGenerator{source: &testCounterStorage{counter: 255}, blockSize: 10, length: 1}
+	if id := g.Generate(nil); !bytes.Equal(id, []byte{255}) {
+		t.Error(id)
+	}
+	if id := g.Generate(nil); id != nil {
+		t.Error(id)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestFeistelPermutation(t *testing.T) {
+	p := newFeistelPermutation(16, sipHashKey)
+	seen := make(map[uint64]bool)
+	sequential := 0
+	for i := uint64(0); i < 1<<16; i++ {
+		permuted := p.Permute(i)
+		if permuted >= 1<<16 || seen[permuted] {
+			t.Fatal(i, permuted)
+		}
+		seen[permuted] = true
+		if p.Inverse(permuted) != i {
+			t.Fatal(i, permuted)
+		}
+		if i > 0 && permuted == p.Permute(i-1)+1 {
+			sequential++
+		}
+	}
+	if sequential > 100 {
+		t.Error(sequential)
+	}
+
+	p = newFeistelPermutation(64, sipHashKey)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		number := r.Uint64()
+		if p.Inverse(p.Permute(number)) != number {
+			t.Error(number)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestCreateLink_CounterFailed(t *testing.T) {
+	handlerTestInit()
+	defer handlerTestInit()
+
+	source := &testCounterStorage{}
+	idCounterSource = source
+	if err := setupIds("counter", "base64", 6); err != nil {
+		t.Fatal(err)
+	}
+	if id, _, err := createLink([]byte("http://example.com"), linkOptions{}); err != nil || !bytes.Equal(id, make([]byte, 6)) {
+		t.Error(id, err)
+	}
+
+	source.err = errors.New("test")
+	*counterBlockSize = 1
+	defer func() { *counterBlockSize = 100 }()
+	if err := setupIds("counter", "base64", 6); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := createLink([]byte("http://example.com"), linkOptions{}); err != errIdNotGenerated {
+		t.Error(err)
+	}
+	if results := createLinks([][]byte{[]byte("http://example.com")}); results[0].Err != errIdNotGenerated {
+		t.Error(results[0].Err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageRedis_LeaseCounter(t *testing.T) {
+	s := redisInit(t)
+	if first, err := s.LeaseCounter(10); err != nil || first != 0 {
+		t.Error(first, err)
+	}
+	if first, err := s.LeaseCounter(10); err != nil || first != 10 {
+		t.Error(first, err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageTarantool_LeaseCounter(t *testing.T) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			t.Skip(err)
+		}
+	}()
+
+	s := tarantoolTestInit()
+	defer s.Close()
+	if first, err := s.LeaseCounter(10); err != nil || first != 0 {
+		t.Error(first, err)
+	}
+	if first, err := s.LeaseCounter(10); err != nil || first != 10 {
+		t.Error(first, err)
+	}
+}
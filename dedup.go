@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"log"
+)
+
+// dedupKeyPrefix separate reverse index items (long url → id) from links in storage
+var dedupKeyPrefix = []byte("dedup/")
+
+// dedupKey return key of reverse index item: sha256 of normalized url, so key length doesn't depend on url length.
+func dedupKey(urlBytes []byte) []byte {
+	hash := sha256.Sum256(normalizeStoredUrl(urlBytes))
+	res := make([]byte, len(dedupKeyPrefix)+len(hash))
+	copy(res, dedupKeyPrefix)
+	copy(res[len(dedupKeyPrefix):], hash[:])
+	return res
+}
+
+// createDedupLink return existing link with same url or create new link and reverse index item for it.
+func createDedupLink(urlBytes []byte, record linkRecord, value []byte) (id []byte, resRecord linkRecord, err error) {
+	key := dedupKey(urlBytes)
+
+	var existingId []byte
+	bytesForHash := urlBytes
+	for tryIndex := 0; tryIndex < *maxRetryCount; tryIndex++ {
+		id = hashFunc(bytesForHash)
+		if id == nil {
+			return nil, linkRecord{}, errIdNotGenerated
+		}
+		existingId, err = storeDedup(storage, key, id, value)
+		if err != errDuplicate {
+			break
+		}
+		bytesForHash = id
+	}
+	if err != nil {
+		return nil, linkRecord{}, err
+	}
+	if existingId == nil {
+		return id, record, nil
+	}
+
+	existingRecord, err := loadDedupLink(existingId, urlBytes)
+	if err == nil {
+		return existingId, existingRecord, nil
+	}
+	if err != errNoKey {
+		return nil, linkRecord{}, err
+	}
+
+	// reverse index item is stale: the link was deleted or changed. Replace the item by new link.
+	id, err = storeGeneratedLink(urlBytes, value, record.storageExpireAt())
+	if err != nil {
+		return nil, linkRecord{}, err
+	}
+	if mutableStorage, ok := storage.(MutableStorage); ok {
+		if err = mutableStorage.Update(key, existingId, id); err != nil && err != errValueMismatch {
+			log.Printf("Can't update reverse index item for '%s': %v", urlBytes, err)
+		}
+	}
+	return id, record, nil
+}
+
+// loadDedupLink load link by id from reverse index. Return errNoKey if the link doesn't exist or has other url.
+func loadDedupLink(id, urlBytes []byte) (linkRecord, error) {
+	value, err := storage.Get(id)
+	if err != nil {
+		return linkRecord{}, err
+	}
+	record, err := unmarshalLinkRecord(value)
+	if err != nil {
+		return linkRecord{}, httpErrInternal.withErr(err)
+	}
+	if !bytes.Equal(normalizeStoredUrl(record.Url), normalizeStoredUrl(urlBytes)) {
+		return linkRecord{}, errNoKey
+	}
+	return record, nil
+}
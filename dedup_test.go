@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+//nolint:deadcode,megacheck
+func TestDedup_SameUrl(t *testing.T) {
+	handlerTestInit()
+	*dedupLinks = true
+	defer func() { *dedupLinks = false }()
+
+	id := handlerTestStore(t, "http://example.com/page")
+	if other := handlerTestStore(t, "http://example.com/page"); other != id {
+		t.Error(id, other)
+	}
+	if other := handlerTestStore(t, "http://EXAMPLE.com/page"); other != id {
+		t.Error(id, other)
+	}
+	if other := handlerTestStore(t, "http://example.com/other"); other == id {
+		t.Error(id, other)
+	}
+
+	// links with options are never deduplicated
+	ctx := handlerTestRequest("GET", "/?url=http://example.com/page&expires_in=1h")
+	if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) == "http://sho.rt/"+id {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	ctx = handlerTestRequestBody("POST", "/api/v1/links/batch", []byte("http://example.com/page\nhttp://example.com/page"))
+	var resp apiBatchResponse
+	if err := json.Unmarshal(ctx.Response.Body(), &resp); err != nil || len(resp.Results) != 2 {
+		t.Fatal(err, string(ctx.Response.Body()))
+	}
+	for _, res := range resp.Results {
+		if res.Link == nil || res.Link.Id != id {
+			t.Error(string(ctx.Response.Body()))
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestDedup_StaleIndex(t *testing.T) {
+	handlerTestInit()
+	*dedupLinks = true
+	defer func() { *dedupLinks = false }()
+	s := storage.(*StorageMap)
+
+	id := handlerTestStore(t, "http://example.com/page")
+	decodedId, _ := decodeLinkId([]byte(id))
+	if err := s.Delete(decodedId); err != nil {
+		t.Fatal(err)
+	}
+
+	newId := handlerTestStore(t, "http://example.com/page")
+	if newId == id {
+		t.Error(id)
+	}
+	if other := handlerTestStore(t, "http://example.com/page"); other != newId {
+		t.Error(newId, other)
+	}
+	decodedNewId, _ := decodeLinkId([]byte(newId))
+	if indexValue, err := s.Get(dedupKey([]byte("http://example.com/page"))); err != nil || string(indexValue) != string(decodedNewId) {
+		t.Error(err, indexValue)
+	}
+}
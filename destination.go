@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policies of destination addresses, selected by -destination-policy flag
+const (
+	// destinationAny allow any hosts
+	destinationAny = "any"
+
+	// destinationPublicIp reject literal ip addresses of private and reserved networks and numeric hosts
+	// in non-standard notation
+	destinationPublicIp = "public-ip"
+
+	// destinationPublic check addresses of host names too
+	destinationPublic = "public"
+)
+
+var (
+	errObfuscatedIp  = errors.New("Ip address in non-standard notation")
+	errNotPublicIp   = errors.New("Address isn't public")
+	errNoHostAddress = errors.New("Host has no addresses")
+)
+
+// hostResolver resolve host names to addresses. net.DefaultResolver implements it.
+type hostResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+var (
+	destinationPolicy                      = destinationPublicIp
+	destinationResolver       hostResolver = net.DefaultResolver
+	destinationResolveTimeout              = 2 * time.Second
+)
+
+// reservedNetworks are private (RFC 1918, RFC 4193) and special purpose networks (RFC 6890), which aren't covered
+// by methods of net.IP in all supported Go versions
+var reservedNetworks = func() []*net.IPNet {
+	var res []*net.IPNet
+	for _, cidr := range []string{
+		"10.0.0.0/8",      // private
+		"172.16.0.0/12",   // private
+		"192.168.0.0/16",  // private
+		"fc00::/7",        // unique local
+		"0.0.0.0/8",       // "this" network
+		"100.64.0.0/10",   // shared address space (carrier-grade NAT)
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // TEST-NET-1
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // TEST-NET-2
+		"203.0.113.0/24",  // TEST-NET-3
+		"240.0.0.0/4",     // reserved, includes broadcast
+		"64:ff9b::/96",    // NAT64, can translate to any IPv4 address
+		"2001:db8::/32",   // documentation
+		"2002::/16",       // 6to4, can translate to any IPv4 address
+		"100::/64",        // discard
+		"::ffff:0:0:0/96", // IPv4-translated
+		"2001::/32",       // Teredo
+		"2001:10::/28",    // ORCHID
+		"fec0::/10",       // deprecated site-local
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, network)
+	}
+	return res
+}()
+
+// isPublicIp return false for loopback, private, link-local, multicast, unspecified and other reserved addresses.
+func isPublicIp(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLooseIPv4 parse IPv4 address in all notations, which are accepted by inet_aton and many http clients:
+// 1 to 4 parts, every part is decimal, octal (leading 0) or hex (leading 0x), last part fill rest bytes of address.
+// For example 2130706433, 0x7f000001, 0177.0.0.1 and 127.1 are all 127.0.0.1.
+func parseLooseIPv4(host string) (net.IP, bool) {
+	host = strings.TrimSuffix(host, ".")
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil, false
+	}
+
+	var res uint64
+	for i, part := range parts {
+		digits, base := part, 10
+		switch {
+		case len(part) > 2 && (part[:2] == "0x" || part[:2] == "0X"):
+			digits, base = part[2:], 16
+		case len(part) > 1 && part[0] == '0':
+			digits, base = part[1:], 8
+		}
+		if digits == "" || digits[0] == '+' || digits[0] == '-' {
+			return nil, false
+		}
+		value, err := strconv.ParseUint(digits, base, 32)
+		if err != nil {
+			return nil, false
+		}
+		if i < len(parts)-1 {
+			if value > 0xff {
+				return nil, false
+			}
+			res |= value << uint(8*(3-i))
+			continue
+		}
+		restBits := uint(8 * (4 - i))
+		if restBits < 32 && value>>restBits != 0 {
+			return nil, false
+		}
+		res |= value
+	}
+	return net.IPv4(byte(res>>24), byte(res>>16), byte(res>>8), byte(res)), true
+}
+
+// checkDestination check host of url by destinationPolicy.
+func checkDestination(urlBytes []byte) error {
+	if destinationPolicy == destinationAny {
+		return nil
+	}
+	u, err := url.Parse(string(urlBytes))
+	if err != nil {
+		return httpErrBadUrl.withErr(err)
+	}
+	if !hasNetworkHost(u) {
+		return nil
+	}
+	host := u.Hostname()
+
+	ipHost := host
+	if index := strings.IndexByte(ipHost, '%'); index >= 0 {
+		// zone of IPv6 address
+		ipHost = ipHost[:index]
+	}
+	if ip := net.ParseIP(ipHost); ip != nil {
+		if !isPublicIp(ip) {
+			return httpErrPrivateDestination.withErr(fmt.Errorf("%v: %v", errNotPublicIp, ip))
+		}
+		return nil
+	}
+	if ip, ok := parseLooseIPv4(host); ok {
+		return httpErrPrivateDestination.withErr(fmt.Errorf("%v: '%v' is %v", errObfuscatedIp, host, ip))
+	}
+
+	// names for loopback by RFC 6761
+	lowerHost := strings.TrimSuffix(strings.ToLower(host), ".")
+	if lowerHost == "localhost" || strings.HasSuffix(lowerHost, ".localhost") {
+		return httpErrPrivateDestination.withErr(fmt.Errorf("%v: %v", errNotPublicIp, host))
+	}
+
+	if destinationPolicy != destinationPublic {
+		return nil
+	}
+	return checkHostAddresses(host)
+}
+
+// checkHostAddresses resolve host by destinationResolver and check all its addresses. Host, which can't be
+// resolved, is rejected.
+func checkHostAddresses(host string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), destinationResolveTimeout)
+	defer cancel()
+
+	addresses, err := destinationResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return httpErrPrivateDestination.withErr(fmt.Errorf("Can't resolve host '%v': %v", host, err))
+	}
+	if len(addresses) == 0 {
+		return httpErrPrivateDestination.withErr(fmt.Errorf("%v: %v", errNoHostAddress, host))
+	}
+	for _, address := range addresses {
+		if !isPublicIp(address.IP) {
+			return httpErrPrivateDestination.withErr(fmt.Errorf("%v: '%v' has address %v", errNotPublicIp, host, address.IP))
+		}
+	}
+	return nil
+}
+
+// setupDestinationPolicy check policy name and set policy and timeout of resolving host names.
+func setupDestinationPolicy(policy string, resolveTimeout time.Duration) error {
+	switch policy {
+	case destinationAny, destinationPublicIp, destinationPublic:
+	default:
+		return fmt.Errorf("Unknown destination policy: '%v'", policy)
+	}
+	destinationPolicy = policy
+	destinationResolveTimeout = resolveTimeout
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+// testResolver resolve host names by map, missed names are resolve errors
+type testResolver map[string][]string
+
+func (r testResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addresses, ok := r[host]
+	if !ok {
+		return nil, errors.New("test: host not found")
+	}
+	res := make([]net.IPAddr, len(addresses))
+	for i, address := range addresses {
+		res[i] = net.IPAddr{IP: net.ParseIP(address)}
+	}
+	return res, nil
+}
+
+//nolint:deadcode,megacheck
+func TestParseLooseIPv4(t *testing.T) {
+	table := []struct {
+		host string
+		ip   string
+	}{
+		{"127.0.0.1", "127.0.0.1"},
+		{"2130706433", "127.0.0.1"},
+		{"0x7f000001", "127.0.0.1"},
+		{"0X7F000001", "127.0.0.1"},
+		{"017700000001", "127.0.0.1"},
+		{"0177.0.0.1", "127.0.0.1"},
+		{"0x7f.0x0.0x0.0x1", "127.0.0.1"},
+		{"127.1", "127.0.0.1"},
+		{"127.0.1", "127.0.0.1"},
+		{"10.0x10203", "10.1.2.3"},
+		{"169.254.169.254.", "169.254.169.254"},
+		{"example.com", ""},
+		{"1.2.3.4.5", ""},
+		{"256.0.0.1", ""},
+		{"1.2.65536", ""},
+		{"4294967296", ""},
+		{"08.0.0.1", ""},
+		{"0x", ""},
+		{"1..2", ""},
+		{"1_000", ""},
+		{"0b1", ""},
+		{"+1.2.3.4", ""},
+	}
+	for _, test := range table {
+		ip, ok := parseLooseIPv4(test.host)
+		if test.ip == "" && ok || test.ip != "" && (!ok || !ip.Equal(net.ParseIP(test.ip))) {
+			t.Error(test.host, ip, ok)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestCheckDestination(t *testing.T) {
+	defer handlerTestInit()
+
+	table := []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://example.com/", true},
+		{"http://8.8.8.8/", true},
+		{"http://[2a00:1450:4001:82b::200e]/", true},
+		{"http://127.0.0.1/admin", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://10.0.0.5/", false},
+		{"http://172.16.1.1/", false},
+		{"http://192.168.0.1/", false},
+		{"http://10.255.255.255/", false},
+		{"http://11.0.0.1/", true},
+		{"http://172.31.255.255/", false},
+		{"http://172.32.0.1/", true},
+		{"http://172.15.255.255/", true},
+		{"http://192.169.0.1/", true},
+		{"http://[fc00::1]/", false},
+		{"http://[fe00::1]/", true},
+		{"http://100.64.0.1/", false},
+		{"http://0.0.0.0/", false},
+		{"http://224.0.0.1/", false},
+		{"http://255.255.255.255/", false},
+		{"http://[::1]/", false},
+		{"http://[fe80::1%25eth0]/", false},
+		{"http://[fd00::1]/", false},
+		{"http://[ff02::1]/", false},
+		{"http://[::ffff:127.0.0.1]/", false},
+		{"http://[64:ff9b::a00:1]/", false},
+		{"http://2130706433/", false},
+		{"http://0x7f.1/", false},
+		{"http://0177.0.0.1/", false},
+		{"http://8.8.8.010/", false}, // public, but non-standard notation
+		{"http://localhost/", false},
+		{"http://LOCALHOST./", false},
+		{"http://app.localhost/", false},
+	}
+	for _, test := range table {
+		if err := checkDestination([]byte(test.url)); (err == nil) != test.allowed {
+			t.Error(test.url, err)
+		}
+	}
+
+	destinationPolicy = destinationAny
+	if err := checkDestination([]byte("http://127.0.0.1/")); err != nil {
+		t.Error(err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestCheckDestination_Resolve(t *testing.T) {
+	defer handlerTestInit()
+
+	destinationResolver = testResolver{
+		"public.example":   {"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"},
+		"internal.example": {"10.1.2.3"},
+		"mixed.example":    {"93.184.216.34", "127.0.0.1"},
+		"empty.example":    {},
+	}
+	table := []struct {
+		host    string
+		allowed bool
+	}{
+		{"public.example", true},
+		{"internal.example", false},
+		{"mixed.example", false},
+		{"empty.example", false},
+		{"missed.example", false},
+	}
+
+	// host names aren't resolved by public-ip policy
+	for _, test := range table {
+		if err := checkDestination([]byte("http://" + test.host + "/")); err != nil {
+			t.Error(test.host, err)
+		}
+	}
+
+	destinationPolicy = destinationPublic
+	for _, test := range table {
+		if err := checkDestination([]byte("http://" + test.host + "/")); (err == nil) != test.allowed {
+			t.Error(test.host, err)
+		}
+	}
+
+	_, _, err := createLink([]byte("http://internal.example/"), linkOptions{})
+	if toHttpError(err).Code != "private_destination" {
+		t.Error(err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestSetupDestinationPolicy_Errors(t *testing.T) {
+	defer handlerTestInit()
+	if err := setupDestinationPolicy("private", 0); err == nil {
+		t.Error(err)
+	}
+}
@@ -1,15 +1,73 @@
 package main
 
-import "flag"
+import (
+	"flag"
+	"time"
+)
 
 var (
-	bindAddress    = flag.String("bind", ":8080", "Bind address for http handler")
-	storeFolder    = flag.String("store-folder", "_storage", "path to storage folder")
-	urlPrefix      = flag.String("url-prefix", "http://localhost:8080/", "Url prefix before id")
-	urlPrefixBytes []byte
-	maxRetryCount  = flag.Int("max-retry-save", 100, "Max count for save hash on any error")
+	bindAddress     = flag.String("bind", ":8080", "Bind address for http handler")
+	storeFolder     = flag.String("store-folder", "_storage", "path to storage folder")
+	storeFsync      = flag.Bool("store-fsync", false, "Sync files of files storage to disk after every write")
+	storeMigrate    = flag.Bool("store-migrate", false, "Move items of store-folder from flat layout (before subdirectories) to subdirectories and exit")
+	urlPrefix       = flag.String("url-prefix", "http://localhost:8080/", "Url prefix before id")
+	urlPrefixBytes  []byte
+	maxRetryCount   = flag.Int("max-retry-save", 100, "Max count for save hash on any error")
+	maxBatchSize    = flag.Int("max-batch-size", 1000, "Max count of urls in one batch request")
+	idGeneratorName = flag.String("id-generator", "random", "Generator of ids: random|random-crypto|md5|sha256|siphash|counter")
+	idEncodingName  = flag.String("id-encoding", "base64", "Encoding of ids in short urls: base32|base62|base64|readable (case-insensitive, for typing by humans)")
+	idLengthFlag    = flag.Int("id-length", 6, "Length of generated ids in bytes")
+	idCheckChar     = flag.Bool("id-check-char", false, "Add check character to ids of short urls, mistyped ids are rejected without storage access. Short urls, made without check character, stop working")
+
+	sipHashKeysFile        = flag.String("siphash-keys-file", "", "File with keys of siphash generator: line '[*]<id>=<32 hex digits>' for every key, active key is marked by '*'. Keys may be set by URL_SHORT_SIPHASH_KEYS environment variable instead")
+	sipHashAllowDefaultKey = flag.Bool("siphash-allow-default-key", false, "Allow siphash generator with default public key (insecure: ids are predictable)")
+
+	counterFile      = flag.String("counter-file", "_storage.counter", "File of counter for counter generator if storage can't keep counter (files, maps and log). For single instance only")
+	counterBlockSize = flag.Int("counter-block", 100, "Count of numbers, leased by counter generator from counter at once")
+	counterPermute   = flag.Bool("counter-permute", false, "Permute numbers of counter generator by active siphash key, so consecutive ids don't look sequential")
+
+	ownUrlPrefixesList   = flag.String("own-url-prefixes", "", "Other prefixes of short urls of this service, comma separated. Url-prefix is added always")
+	ownLinks             = flag.String("own-links", "reject", "Links to short urls of this service: reject|resolve (save destination of the short url)|allow (chains of links are allowed, cycles are rejected)")
+	shortenerDomainsList = flag.String("shortener-domains", "", "Domains of other url shorteners, comma separated. Links to them and their subdomains are rejected")
+
+	urlSchemesList   = flag.String("url-schemes", "http,https,ftp", "Allowed schemes of urls, comma separated 'scheme[:rule]'. Rules: host (url with host, default for http, https and ftp)|mailto (email addresses, default for mailto)|tel (phone number, default for tel)|any (anything after scheme, default for other schemes). javascript, vbscript, data, file and blob can't be allowed")
+	maxUrlLengthFlag = flag.Int("max-url-length", 3000, "Max length of urls in bytes. Max size of request body is set for batch of max-batch-size such urls")
+
+	dedupLinks = flag.Bool("dedup", false, "Return existing short link for same long url. Links with alias or expiration are never deduplicated")
+
+	hostRulesFileName      = flag.String("host-rules-file", "", "File of host rules 'allow|block <pattern>', first matched rule is applied. Pattern: host, .host (with subdomains), *.host (subdomains only), ip, cidr or *. Reloaded on SIGHUP and on change")
+	hostRulesCheckInterval = flag.Duration("host-rules-check-interval", 10*time.Second, "Interval of check modification time of host rules file")
+
+	destinationPolicyName         = flag.String("destination-policy", "public-ip", "Allowed hosts of urls: any|public-ip (reject private, loopback, link-local, multicast and reserved ip addresses and ip in non-standard notation)|public (resolve host names and check their addresses too)")
+	destinationResolveTimeoutFlag = flag.Duration("destination-resolve-timeout", 2*time.Second, "Timeout of resolving host names for destination policy 'public'")
+
+	redirectCode = flag.Int("redirect-code", 302, "Http status for redirect to long url: 301|302|307|308")
+
+	storageRetryAfter = flag.Int("storage-retry-after", 5, "Retry-After seconds for answers when storage is unavailable")
+
+	expiredRetention     = flag.Duration("expired-retention", 30*24*time.Hour, "How long expired links answer 410 Gone before removal from storage")
+	expiredSweepInterval = flag.Duration("expired-sweep-interval", time.Minute, "Interval of removing expired links from storage")
+
+	clickFlushInterval = flag.Duration("click-flush-interval", time.Second, "Interval of saving buffered click counters to storage, 0 - disable click counting")
+
+	adminToken = flag.String("admin-token", "", "Bearer token for /admin/ endpoints, admin endpoints are disabled if empty")
+
+	storageType = flag.String("storage-type", "files", "files|memory-map|sharded-map|log|redis|tarantool")
+
+	mapShards = flag.Int("map-shards", 64, "Count of independent shards of sharded-map storage")
+
+	mapSnapshotFile     = flag.String("map-snapshot-file", "", "Snapshot file for memory-map storage, empty - keep data in memory only")
+	mapSnapshotInterval = flag.Duration("map-snapshot-interval", 5*time.Minute, "Interval of saving snapshot of memory-map storage")
+	mapJournalFile      = flag.String("map-journal-file", "", "Journal of changes of memory-map storage between snapshots, empty - disable journal")
+	mapJournalFsync     = flag.Bool("map-journal-fsync", false, "Sync journal of memory-map storage to disk after every write")
+
+	logFile            = flag.String("log-file", "_storage.log", "path to file of log storage")
+	logFsync           = flag.Bool("log-fsync", false, "Sync log storage file to disk after every write")
+	logCompactInterval = flag.Duration("log-compact-interval", 10*time.Minute, "Interval of check garbage in log storage file and compact it")
 
-	storageType = flag.String("storage-type", "files", "files|memory-map|redis|tarantool")
+	cacheEntries     = flag.Int("cache-entries", 0, "Max count of items in read cache before storage, 0 - disable cache")
+	cacheBytes       = flag.Int("cache-bytes", 64*1024*1024, "Max size of keys and values in read cache")
+	cacheNegativeTTL = flag.Duration("cache-negative-ttl", 0, "How long read cache remember missed keys, 0 - don't cache missed keys")
 
 	redisAddress  = flag.String("redis-addr", "127.0.0.1:6379", "redis addr")
 	redisDatabase = flag.Int("redis-database", 0, "")
@@ -18,5 +76,7 @@ var (
 	tarantoolUser     = flag.String("tarantool-user", "admin", "")
 	tarantoolPassword = flag.String("tarantool-password", "", "")
 	tarantoolSpace    = flag.String("tarantool-space", "url-short",
-		"Space have to be existed. In space have to be existed primary index for first field, type scalar.")
+		"Space have to be existed. In space have to be existed primary index for first field, type scalar. "+
+			"Secondary index by expiration time is created on start. "+
+			"Same space with suffix '_stats' is used for click stats, click stats are disabled if it doesn't exist.")
 )
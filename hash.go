@@ -38,6 +38,7 @@ func hashSha256_64Bit(value []byte) []byte {
 	return hash[:8]
 }
 
+// sipHashKey is public default key. It is used by benchmarks and, only if explicitly allowed, by siphash generator.
 var sipHashKey = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
 
 func hashSipDchest_48bit(value []byte) []byte {
@@ -91,3 +92,50 @@ func hashRandom_48Bit([]byte) []byte {
 	rand.Read(res)
 	return res
 }
+
+// idGenerator make HashFunc for ids of given length in bytes
+type idGenerator struct {
+	// MaxLength is max length of id in bytes, 0 - unlimited
+	MaxLength int
+
+	// New return nil if generator isn't configured
+	New func(length int) HashFunc
+}
+
+// idGenerators is registry of generators, selectable by -id-generator flag
+var idGenerators = map[string]idGenerator{
+	"random": {New: func(length int) HashFunc {
+		return func([]byte) []byte {
+			res := make([]byte, length)
+			//nolint:errcheck,gas
+			rand.Read(res)
+			return res
+		}
+	}},
+	"random-crypto": {New: func(length int) HashFunc {
+		return func([]byte) []byte {
+			res := make([]byte, length)
+			if _, err := cryptorand.Read(res); err != nil {
+				panic(err)
+			}
+			return res
+		}
+	}},
+	"md5": {MaxLength: md5.Size, New: truncatedHashFunc(func(value []byte) []byte {
+		//nolint:gas
+		hash := md5.Sum(value)
+		return hash[:]
+	})},
+	"sha256":  {MaxLength: sha256.Size, New: truncatedHashFunc(hashSha256)},
+	"siphash": {MaxLength: 8, New: newSipHashFunc},
+	"counter": {MaxLength: 8, New: newCounterHashFunc},
+}
+
+// truncatedHashFunc make generator, which use first bytes of full hash
+func truncatedHashFunc(fullHash HashFunc) func(length int) HashFunc {
+	return func(length int) HashFunc {
+		return func(value []byte) []byte {
+			return fullHash(value)[:length]
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type hostRuleKind int
+
+const (
+	hostRuleAny      hostRuleKind = iota // *
+	hostRuleExact                        // example.com
+	hostRuleSuffix                       // .example.com - the host and its subdomains
+	hostRuleWildcard                     // *.example.com - subdomains only
+	hostRuleNetwork                      // 10.0.0.0/8 or single ip
+)
+
+// hostRule is one line of rules file: "allow <pattern>" or "block <pattern>".
+type hostRule struct {
+	Block   bool
+	Kind    hostRuleKind
+	Host    string
+	Network *net.IPNet
+
+	// Line is line number in rules file and Text is the rule as written there, for messages
+	Line int
+	Text string
+}
+
+func (r hostRule) String() string {
+	return fmt.Sprintf("'%v' (line %v)", r.Text, r.Line)
+}
+
+func (r hostRule) Match(host string, ip net.IP) bool {
+	switch r.Kind {
+	case hostRuleAny:
+		return true
+	case hostRuleExact:
+		return host == r.Host
+	case hostRuleSuffix:
+		return host == r.Host || strings.HasSuffix(host, "."+r.Host)
+	case hostRuleWildcard:
+		return strings.HasSuffix(host, "."+r.Host)
+	case hostRuleNetwork:
+		return ip != nil && r.Network.Contains(ip)
+	default:
+		return false
+	}
+}
+
+// hostRules is ordered list of rules, first matched rule is applied. Hosts without matched rule are allowed,
+// so allowlist ends by "block *".
+type hostRules []hostRule
+
+// parseHostRules parse rules: one rule per line, '#' start comment. Hosts of rules are normalized same way as
+// hosts of urls: lower case and punycode.
+func parseHostRules(text string) (hostRules, error) {
+	var res hostRules
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if index := strings.IndexByte(line, '#'); index >= 0 {
+			line = line[:index]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Bad host rule at line %v: '%v'", lineNumber, line)
+		}
+
+		rule := hostRule{Line: lineNumber, Text: strings.Join(fields, " ")}
+		switch fields[0] {
+		case "allow":
+		case "block":
+			rule.Block = true
+		default:
+			return nil, fmt.Errorf("Unknown action of host rule at line %v: '%v'", lineNumber, fields[0])
+		}
+		if err := rule.parsePattern(fields[1]); err != nil {
+			return nil, fmt.Errorf("Bad host rule at line %v: %v", lineNumber, err)
+		}
+		res = append(res, rule)
+	}
+	return res, scanner.Err()
+}
+
+func (r *hostRule) parsePattern(pattern string) error {
+	if pattern == "*" {
+		r.Kind = hostRuleAny
+		return nil
+	}
+	if strings.Contains(pattern, "/") {
+		_, network, err := net.ParseCIDR(pattern)
+		if err != nil {
+			return err
+		}
+		r.Kind, r.Network = hostRuleNetwork, network
+		return nil
+	}
+	if ip := net.ParseIP(strings.Trim(pattern, "[]")); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		r.Kind, r.Network = hostRuleNetwork, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		return nil
+	}
+
+	r.Kind = hostRuleExact
+	switch {
+	case strings.HasPrefix(pattern, "*."):
+		r.Kind, pattern = hostRuleWildcard, pattern[2:]
+	case strings.HasPrefix(pattern, "."):
+		r.Kind, pattern = hostRuleSuffix, pattern[1:]
+	}
+	host, err := normalizeHost(pattern)
+	if err != nil {
+		return err
+	}
+	if host == "" || strings.ContainsAny(host, "*/") {
+		return fmt.Errorf("Bad host pattern: '%v'", pattern)
+	}
+	r.Host = host
+	return nil
+}
+
+// Find return first rule, matched to host of normalized url. Return nil if no rule match.
+func (rules hostRules) Find(host string) *hostRule {
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	for i := range rules {
+		if rules[i].Match(host, ip) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// hostRulesFile keep rules from file and reload them on SIGHUP or change of modification time of the file.
+// Current rules are kept if new file can't be read or parsed.
+type hostRulesFile struct {
+	fileName string
+
+	mutex   sync.RWMutex
+	rules   hostRules
+	modTime time.Time
+}
+
+// hostRulesList is nil if host rules are disabled
+var hostRulesList *hostRulesFile
+
+func loadHostRulesFile(fileName string) (*hostRulesFile, error) {
+	f := &hostRulesFile{fileName: fileName}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *hostRulesFile) Reload() error {
+	stat, err := os.Stat(f.fileName)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(f.fileName)
+	if err != nil {
+		return err
+	}
+	rules, err := parseHostRules(string(content))
+	if err != nil {
+		return fmt.Errorf("Can't parse host rules file '%v': %v", f.fileName, err)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.rules = rules
+	f.modTime = stat.ModTime()
+	return nil
+}
+
+func (f *hostRulesFile) Rules() hostRules {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.rules
+}
+
+// Run reload rules on SIGHUP and if modification time of file is changed, file is checked every interval.
+// It never returns.
+func (f *hostRulesFile) Run(interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+
+	f.mutex.RLock()
+	lastModTime := f.modTime
+	f.mutex.RUnlock()
+	for {
+		select {
+		case <-signals:
+		case <-ticker.C:
+			stat, err := os.Stat(f.fileName)
+			if err != nil || stat.ModTime().Equal(lastModTime) {
+				continue
+			}
+			// broken file is reported once, not every interval
+			lastModTime = stat.ModTime()
+		}
+		if err := f.Reload(); err != nil {
+			log.Printf("Can't reload host rules, old rules are kept: %v", err)
+			continue
+		}
+		f.mutex.RLock()
+		lastModTime = f.modTime
+		f.mutex.RUnlock()
+		log.Printf("Host rules are reloaded from '%v'", f.fileName)
+	}
+}
+
+// checkUrlHost return httpErrBlockedUrl if host of url is blocked by host rules. Urls without network host
+// (mailto, tel, custom app schemes) aren't checked.
+func checkUrlHost(urlBytes []byte) error {
+	if hostRulesList == nil {
+		return nil
+	}
+	u, err := url.Parse(string(urlBytes))
+	if err != nil {
+		return httpErrBadUrl.withErr(err)
+	}
+	if !hasNetworkHost(u) {
+		return nil
+	}
+	// links, saved before normalization, may have not normalized host
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return httpErrBadUrl.withErr(err)
+	}
+	if rule := hostRulesList.Rules().Find(host); rule != nil && rule.Block {
+		return httpErrBlockedUrl.withErr(fmt.Errorf("Host '%v' is blocked by rule %v", host, rule))
+	}
+	return nil
+}
+
+var blockedUrlPageTemplate = template.Must(template.New("blocked").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Link is blocked</title>
+</head>
+<body>
+<h1>Link is blocked</h1>
+<p>The short link leads to a site, which is blocked by administrator of the service: it may be used for phishing
+or other abuse.</p>
+<p>Destination: <code>{{.Url}}</code></p>
+</body>
+</html>
+`))
+
+// writeBlockedUrlPage write warning page instead of redirect to blocked url. Url isn't a link on the page.
+func writeBlockedUrlPage(ctx *fasthttp.RequestCtx, urlBytes []byte, err error) {
+	setHttpErrorHeaders(ctx, toHttpError(err))
+	var buf bytes.Buffer
+	if templateErr := blockedUrlPageTemplate.Execute(&buf, struct{ Url string }{string(urlBytes)}); templateErr != nil {
+		log.Printf("Can't render blocked url page: %v", templateErr)
+		return
+	}
+	ctx.SetContentType("text/html; charset=utf-8")
+	ctx.SetBody(buf.Bytes())
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHostRules = `
+# phishing
+block evil.com
+block .bad.org
+block *.wild.net
+allow good.example
+block .example
+block 10.0.0.0/8
+block 192.168.1.1
+block 2001:db8::/32
+block пример.рф
+block fqdn.example.
+`
+
+//nolint:deadcode,megacheck
+func TestHostRules_Find(t *testing.T) {
+	rules, err := parseHostRules(testHostRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		host    string
+		blocked bool
+	}{
+		{"evil.com", true},
+		{"sub.evil.com", false},
+		{"notevil.com", false},
+		{"bad.org", true},
+		{"a.b.bad.org", true},
+		{"notbad.org", false},
+		{"wild.net", false},
+		{"a.wild.net", true},
+		{"good.example", false},
+		{"other.example", true},
+		{"10.1.2.3", true},
+		{"11.1.2.3", false},
+		{"192.168.1.1", true},
+		{"192.168.1.2", false},
+		{"[2001:db8::1]", true},
+		{"[2001:db9::1]", false},
+		{"xn--e1afmkfd.xn--p1ai", true},
+		{"fqdn.example", true},
+	}
+	for _, test := range table {
+		rule := rules.Find(test.host)
+		if blocked := rule != nil && rule.Block; blocked != test.blocked {
+			t.Error(test.host, rule)
+		}
+	}
+
+	// allowlist
+	rules, err = parseHostRules("allow .example.com\nblock *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule := rules.Find("www.example.com"); rule == nil || rule.Block {
+		t.Error(rule)
+	}
+	if rule := rules.Find("example.org"); rule == nil || !rule.Block || rule.Line != 2 {
+		t.Error(rule)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestParseHostRules_Errors(t *testing.T) {
+	for _, text := range []string{"deny evil.com", "block", "block evil.com extra", "block 10.0.0.0/33", "block *.", "allow a*b.com"} {
+		if _, err := parseHostRules(text); err == nil {
+			t.Error(text)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestHostRulesFile_Reload(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	fileName := filepath.Join(tmpDir, "rules")
+
+	if _, err = loadHostRulesFile(fileName); err == nil {
+		t.Error("Missed file must be error")
+	}
+
+	ioutil.WriteFile(fileName, []byte("block evil.com"), DEFAULT_FILE_MODE)
+	f, err := loadHostRulesFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule := f.Rules().Find("evil.com"); rule == nil {
+		t.Error(rule)
+	}
+
+	// broken file doesn't replace rules
+	ioutil.WriteFile(fileName, []byte("deny other.com"), DEFAULT_FILE_MODE)
+	if err = f.Reload(); err == nil {
+		t.Error(err)
+	}
+	if rule := f.Rules().Find("evil.com"); rule == nil {
+		t.Error(rule)
+	}
+
+	ioutil.WriteFile(fileName, []byte("block other.com"), DEFAULT_FILE_MODE)
+	if err = f.Reload(); err != nil {
+		t.Error(err)
+	}
+	if rule := f.Rules().Find("evil.com"); rule != nil {
+		t.Error(rule)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestHostRules_StoreAndRedirect(t *testing.T) {
+	handlerTestInit()
+	defer handlerTestInit()
+
+	hostRulesList = &hostRulesFile{}
+	encodedId := handlerTestStore(t, "http://example.com/<script>")
+
+	var err error
+	hostRulesList.rules, err = parseHostRules("block example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, u := range []string{"http://EXAMPLE.com/other", "http://example.com./other", "http://example.com../other"} {
+		ctx := handlerTestRequest("GET", "/?url="+u)
+		if ctx.Response.StatusCode() != http.StatusForbidden || string(ctx.Response.Header.Peek("X-Error-Code")) != "blocked_url" {
+			t.Error(u, ctx.Response.StatusCode(), string(ctx.Response.Body()))
+		}
+	}
+	if err = checkUrlHost([]byte("http://example.com./saved-before-normalization")); toHttpError(err).Code != "blocked_url" {
+		t.Error(err)
+	}
+
+	// existing link isn't redirected
+	ctx := handlerTestRequest("GET", "/"+encodedId)
+	body := string(ctx.Response.Body())
+	if ctx.Response.StatusCode() != http.StatusForbidden || len(ctx.Response.Header.Peek("Location")) != 0 {
+		t.Error(ctx.Response.StatusCode())
+	}
+	if !strings.Contains(string(ctx.Response.Header.ContentType()), "text/html") ||
+		!strings.Contains(body, "http://example.com/%3Cscript%3E") || strings.Contains(body, "<script>") {
+		t.Error(body)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+// httpError describe error answer for client. Code is stable machine-readable identifier of the error,
+// it sent in X-Error-Code header and in body.
+type httpError struct {
+	Status int
+	Code   string
+	Err    error
+}
+
+var (
+	httpErrBadRequest         = httpError{Status: http.StatusBadRequest, Code: "bad_request"}
+	httpErrBadId              = httpError{Status: http.StatusBadRequest, Code: "bad_id"}
+	httpErrBadUrl             = httpError{Status: http.StatusBadRequest, Code: "bad_url"}
+	httpErrOwnUrl             = httpError{Status: http.StatusBadRequest, Code: "own_url"}
+	httpErrShortenerUrl       = httpError{Status: http.StatusBadRequest, Code: "shortener_url"}
+	httpErrPrivateDestination = httpError{Status: http.StatusBadRequest, Code: "private_destination"}
+	httpErrBadAlias           = httpError{Status: http.StatusBadRequest, Code: "bad_alias"}
+	httpErrBadExpiration      = httpError{Status: http.StatusBadRequest, Code: "bad_expiration"}
+	httpErrUnauthorized       = httpError{Status: http.StatusUnauthorized, Code: "unauthorized"}
+	httpErrForbidden          = httpError{Status: http.StatusForbidden, Code: "forbidden"}
+	httpErrBlockedUrl         = httpError{Status: http.StatusForbidden, Code: "blocked_url"}
+	httpErrNotFound           = httpError{Status: http.StatusNotFound, Code: "not_found"}
+	httpErrRouteNotFound      = httpError{Status: http.StatusNotFound, Code: "route_not_found"}
+	httpErrMethodNotAllowed   = httpError{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed"}
+	httpErrAliasTaken         = httpError{Status: http.StatusConflict, Code: "alias_taken"}
+	httpErrConflict           = httpError{Status: http.StatusConflict, Code: "conflict"}
+	httpErrLinkCycle          = httpError{Status: http.StatusConflict, Code: "link_cycle"}
+	httpErrGone               = httpError{Status: http.StatusGone, Code: "expired"}
+	httpErrInternal           = httpError{Status: http.StatusInternalServerError, Code: "internal_error"}
+	httpErrIdGenerationFailed = httpError{Status: http.StatusInternalServerError, Code: "id_generation_failed"}
+	httpErrNotSupported       = httpError{Status: http.StatusNotImplemented, Code: "not_supported"}
+	httpErrStorageUnavailable = httpError{Status: http.StatusServiceUnavailable, Code: "storage_unavailable"}
+)
+
+func (e httpError) Error() string {
+	if e.Err == nil {
+		return e.Code
+	}
+	return e.Code + ": " + e.Err.Error()
+}
+
+func (e httpError) withErr(err error) httpError {
+	e.Err = err
+	return e
+}
+
+// toHttpError convert any error to answer for client. Errors from storage are mapped by meaning.
+func toHttpError(err error) httpError {
+	if httpErr, ok := err.(httpError); ok {
+		return httpErr
+	}
+
+	switch err {
+	case errNoKey:
+		return httpErrNotFound.withErr(err)
+	case errDuplicate:
+		return httpErrIdGenerationFailed.withErr(err)
+	case errValueMismatch:
+		return httpErrConflict.withErr(err)
+	case errNotSupported:
+		return httpErrNotSupported.withErr(err)
+	default:
+		return httpErrStorageUnavailable.withErr(err)
+	}
+}
+
+func setHttpErrorHeaders(ctx *fasthttp.RequestCtx, httpErr httpError) {
+	if httpErr.Status >= http.StatusInternalServerError {
+		log.Printf("Error while handle request '%s': %v", ctx.RequestURI(), httpErr)
+	}
+
+	ctx.Response.ResetBody()
+	ctx.Response.Header.Set("X-Error-Code", httpErr.Code)
+	if httpErr.Status == http.StatusServiceUnavailable {
+		ctx.Response.Header.Set("Retry-After", strconv.Itoa(*storageRetryAfter))
+	}
+	ctx.SetStatusCode(httpErr.Status)
+}
+
+// writeHttpError write error as text: first line is error code, second - error message if exist.
+func writeHttpError(ctx *fasthttp.RequestCtx, err error) {
+	httpErr := toHttpError(err)
+	setHttpErrorHeaders(ctx, httpErr)
+	ctx.SetContentType("text/plain")
+
+	body := httpErr.Code + "\n"
+	if httpErr.Err != nil {
+		body += httpErr.Err.Error() + "\n"
+	}
+	ctx.SetBodyString(body)
+}
+
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// writeApiError write error as json object: {"error": {"code": "...", "message": "..."}}
+func writeApiError(ctx *fasthttp.RequestCtx, err error) {
+	httpErr := toHttpError(err)
+	setHttpErrorHeaders(ctx, httpErr)
+
+	writeApiJson(ctx, httpErr.Status, apiErrorResponse{Error: newApiError(httpErr)})
+}
+
+func newApiError(httpErr httpError) apiError {
+	res := apiError{Code: httpErr.Code}
+	if httpErr.Err != nil {
+		res.Message = httpErr.Err.Error()
+	}
+	return res
+}
+
+func writeApiJson(ctx *fasthttp.RequestCtx, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Can't marshal json answer: %v", err)
+		ctx.Response.ResetBody()
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		return
+	}
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(status)
+	ctx.SetBody(body)
+}
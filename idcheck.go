@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+)
+
+var (
+	errBadIdCheckChar        = errors.New("Check character of id doesn't match")
+	errIdSymbolMissedOrExtra = errors.New("Id is one symbol shorter or longer than id with check character")
+)
+
+// idCheckFailures count short urls, rejected by check character: with id of right length and wrong check character
+// or with id, which is one symbol shorter or longer
+var idCheckFailures = expvar.NewInt("id_check_failures")
+
+// withIdCheckChar add check character (Luhn mod N over alphabet of encoding) after encoded id. Decode reject ids with
+// wrong check character before decoding, so single mistyped symbol and most swaps of neighbour symbols are found
+// without storage access.
+func withIdCheckChar(encoding IdEncoding) IdEncoding {
+	alphabet := encoding.Alphabet
+	var symbolIndex [256]int
+	for i := range symbolIndex {
+		symbolIndex[i] = -1
+	}
+	for i := 0; i < len(alphabet); i++ {
+		symbolIndex[alphabet[i]] = i
+	}
+	if encoding.Normalize != nil {
+		for c := range symbolIndex {
+			symbolIndex[c] = symbolIndex[encoding.Normalize(byte(c))]
+		}
+	}
+
+	checkChar := func(encoded []byte) (byte, bool) {
+		n := len(alphabet)
+		factor := 2
+		sum := 0
+		for i := len(encoded) - 1; i >= 0; i-- {
+			index := symbolIndex[encoded[i]]
+			if index < 0 {
+				return 0, false
+			}
+			addend := factor * index
+			sum += addend/n + addend%n
+			factor = 3 - factor
+		}
+		return alphabet[(n-sum%n)%n], true
+	}
+
+	return IdEncoding{
+		Alphabet:  alphabet,
+		Normalize: encoding.Normalize,
+		CheckChar: true,
+		Encode: func(prefix, id []byte) []byte {
+			res := encoding.Encode(prefix, id)
+			c, _ := checkChar(res[len(prefix):])
+			return append(res, c)
+		},
+		Decode: func(val []byte) ([]byte, error) {
+			if len(val) == 0 {
+				return nil, errBadIdLength
+			}
+			encoded := val[:len(val)-1]
+			c, ok := checkChar(encoded)
+			if !ok {
+				return nil, errBadIdSymbol
+			}
+			if symbolIndex[c] != symbolIndex[val[len(val)-1]] {
+				return nil, errBadIdCheckChar
+			}
+			return encoding.Decode(encoded)
+		},
+	}
+}
+
+// isMistypedIdLen return true if id with check character has one missed or extra symbol with the length. Aliases
+// of such length are not allowed, so the id is rejected without storage access.
+func isMistypedIdLen(encodedLen int) bool {
+	return idEncoding.CheckChar && (isEncodedIdLen(encodedLen-1) || isEncodedIdLen(encodedLen+1))
+}
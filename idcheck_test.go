@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"testing"
+)
+
+//nolint:deadcode,megacheck
+func TestWithIdCheckChar_DetectTypos(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for name, encoding := range idEncodings {
+		checked := withIdCheckChar(encoding)
+		for i := 0; i < 50; i++ {
+			id := make([]byte, 6)
+			r.Read(id)
+			encoded := checked.Encode(nil, id)
+			if decoded, err := checked.Decode(encoded); err != nil || !bytes.Equal(decoded, id) {
+				t.Fatal(name, id, string(encoded), decoded, err)
+			}
+
+			// every replace of one symbol
+			for pos := range encoded {
+				for j := 0; j < len(encoding.Alphabet); j++ {
+					if encoding.Alphabet[j] == encoded[pos] {
+						continue
+					}
+					mistyped := append([]byte(nil), encoded...)
+					mistyped[pos] = encoding.Alphabet[j]
+					if _, err := checked.Decode(mistyped); err != errBadIdCheckChar {
+						t.Fatal(name, string(encoded), string(mistyped), err)
+					}
+				}
+			}
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestWithIdCheckChar_DecodeErrors(t *testing.T) {
+	checked := withIdCheckChar(idEncodings["base64"])
+	for _, encoded := range []string{"", "AAAA$AAA"} {
+		if res, err := checked.Decode([]byte(encoded)); err == nil || err == errBadIdCheckChar {
+			t.Error(encoded, res, err)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestHandleReadRequest_IdCheckChar(t *testing.T) {
+	handlerTestInit()
+	defer handlerTestInit()
+	*idCheckChar = true
+	if err := setupIds("random", "base64", 6); err != nil {
+		t.Fatal(err)
+	}
+
+	encodedId := handlerTestStore(t, "http://example.com")
+	if len(encodedId) != 9 {
+		t.Fatal(encodedId)
+	}
+	if ctx := handlerTestRequest("GET", "/"+encodedId); ctx.Response.StatusCode() != *redirectCode {
+		t.Error(ctx.Response.StatusCode())
+	}
+
+	// mistyped id is rejected without storage access
+	storage = storageFailing{}
+	mistyped := []byte(encodedId)
+	if mistyped[0] = idEncoding.Alphabet[0]; encodedId[0] == mistyped[0] {
+		mistyped[0] = idEncoding.Alphabet[1]
+	}
+	failures := idCheckFailures.Value()
+	ctx := handlerTestRequest("GET", "/"+string(mistyped))
+	if ctx.Response.StatusCode() != http.StatusBadRequest || string(ctx.Response.Header.Peek("X-Error-Code")) != "bad_id" {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+	if idCheckFailures.Value() != failures+1 {
+		t.Error(idCheckFailures.Value(), failures)
+	}
+
+	// missed or extra symbol is rejected without storage access too, such aliases can't be created
+	for _, mistyped := range []string{encodedId[:len(encodedId)-1], encodedId[1:], encodedId + "A", "A" + encodedId} {
+		failures = idCheckFailures.Value()
+		ctx = handlerTestRequest("GET", "/"+mistyped)
+		if ctx.Response.StatusCode() != http.StatusBadRequest || string(ctx.Response.Header.Peek("X-Error-Code")) != "bad_id" {
+			t.Error(mistyped, ctx.Response.StatusCode(), string(ctx.Response.Body()))
+		}
+		if idCheckFailures.Value() != failures+1 {
+			t.Error(mistyped, idCheckFailures.Value(), failures)
+		}
+		if err := checkAlias([]byte(mistyped)); err != errAliasCheckedIdLength {
+			t.Error(mistyped, err)
+		}
+	}
+	if err := checkAlias([]byte("alias-of-11")); err != nil {
+		t.Error(err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestWithIdCheckChar_Normalize(t *testing.T) {
+	checked := withIdCheckChar(idEncodings["readable"])
+	id := []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab}
+	encoded := checked.Encode(nil, id)
+	if res, err := checked.Decode(bytes.ToLower(encoded)); err != nil || !bytes.Equal(res, id) {
+		t.Error(string(encoded), res, err)
+	}
+}
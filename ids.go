@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+)
+
+// setupIds select generator and encoding of ids by names from registries. It refuse combinations, which can't be
+// decoded back: ids of every value must be encoded with same length and decoded to same bytes.
+// Check character is added to encoding if -id-check-char is set.
+func setupIds(generatorName, encodingName string, length int) error {
+	generator, ok := idGenerators[generatorName]
+	if !ok {
+		return fmt.Errorf("Unknown id generator: '%v'", generatorName)
+	}
+	if length < 1 || generator.MaxLength > 0 && length > generator.MaxLength {
+		return fmt.Errorf("Id generator '%v' support length from 1 to %v bytes, got: %v", generatorName,
+			generator.MaxLength, length)
+	}
+
+	encoding, ok := idEncodings[encodingName]
+	if !ok {
+		return fmt.Errorf("Unknown id encoding: '%v'", encodingName)
+	}
+	if *idCheckChar {
+		if encoding.Alphabet == "" {
+			return fmt.Errorf("Id encoding '%v' doesn't support check character", encodingName)
+		}
+		encoding = withIdCheckChar(encoding)
+	}
+	if err := checkIdEncoding(encoding, length); err != nil {
+		return fmt.Errorf("Id encoding '%v' can't be used with length %v: %v", encodingName, length, err)
+	}
+
+	hash := generator.New(length)
+	if hash == nil {
+		return fmt.Errorf("Id generator '%v' isn't configured", generatorName)
+	}
+
+	hashFunc = hash
+	idEncoding = encoding
+	idLength = length
+	return nil
+}
+
+// checkIdEncoding encode and decode ids with edge and random values
+func checkIdEncoding(encoding IdEncoding, length int) error {
+	samples := [][]byte{make([]byte, length), bytes.Repeat([]byte{0xff}, length)}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		sample := make([]byte, length)
+		//nolint:errcheck
+		r.Read(sample)
+		samples = append(samples, sample)
+	}
+
+	encodedLen := len(encoding.Encode(nil, samples[0]))
+	for _, sample := range samples {
+		encoded := encoding.Encode(nil, sample)
+		if len(encoded) != encodedLen {
+			return fmt.Errorf("Encoded ids have different length: %v and %v", encodedLen, len(encoded))
+		}
+		decoded, err := encoding.Decode(encoded)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(decoded, sample) {
+			return fmt.Errorf("Id '%x' decoded as '%x'", sample, decoded)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"net/http"
+	"testing"
+)
+
+//nolint:deadcode,megacheck
+func TestSetupIds_Errors(t *testing.T) {
+	defer handlerTestInit()
+
+	table := []struct {
+		generator string
+		encoding  string
+		length    int
+	}{
+		{"unknown", "base64", 6},
+		{"random", "unknown", 6},
+		{"random", "base64", 0},
+		{"md5", "base64", 17},
+		{"siphash", "base64", 9},
+		{"counter", "base64", 6}, // source of numbers isn't set
+	}
+	for _, test := range table {
+		if err := setupIds(test.generator, test.encoding, test.length); err == nil {
+			t.Error(test)
+		}
+	}
+	if idLength != 6 {
+		t.Error(idLength)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestCheckIdEncoding(t *testing.T) {
+	// encoding without leading zeroes
+	variableLenBase62 := IdEncoding{
+		Encode: func(prefix, val []byte) []byte {
+			bigInt := big.Int{}
+			bigInt.SetBytes(val)
+			return bigInt.Append(prefix, 62)
+		},
+		Decode: decodeUrlBase62,
+	}
+	if err := checkIdEncoding(variableLenBase62, 6); err == nil {
+		t.Error(err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestSetupIds_Generators(t *testing.T) {
+	defer handlerTestInit()
+
+	for name, generator := range idGenerators {
+		length := 32
+		if generator.MaxLength > 0 {
+			length = generator.MaxLength
+		}
+		for ; length > 0; length-- {
+			idCounterSource = &testCounterStorage{}
+			if err := setupIds(name, "base64", length); err != nil {
+				t.Fatal(name, length, err)
+			}
+			if id := hashFunc([]byte("http://example.com")); len(id) != length {
+				t.Error(name, length, id)
+			}
+		}
+	}
+
+	if err := setupIds("siphash", "base64", 6); err != nil {
+		t.Fatal(err)
+	}
+	// id of key is added before value
+	if id := hashFunc(benchmarkBytesForHash); !bytes.Equal(id, hashSipDchestFast_48bit(append([]byte{0}, benchmarkBytesForHash...))) {
+		t.Error(id)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestSetupIds_Handler(t *testing.T) {
+	handlerTestInit()
+	defer handlerTestInit()
+	if err := setupIds("sha256", "base64", 12); err != nil {
+		t.Fatal(err)
+	}
+
+	id := handlerTestStore(t, "http://example.com/long-id")
+	if len(id) != 16 {
+		t.Error(id)
+	}
+	ctx := handlerTestRequest("GET", "/"+id)
+	if ctx.Response.StatusCode() != http.StatusFound {
+		t.Error(ctx.Response.StatusCode())
+	}
+
+	// id of other length is not generated id
+	ctx = handlerTestRequest("GET", "/"+string(idEncoding.Encode(nil, []byte("123456"))))
+	if ctx.Response.StatusCode() != http.StatusNotFound {
+		t.Error(ctx.Response.StatusCode())
+	}
+}
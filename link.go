@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const (
+	linkRecordVersion1 = 1
+	linkRecordVersion2 = 2
+
+	linkRecordHeaderLenV1 = 1 + 8
+	linkRecordHeaderLenV2 = 1 + 8 + 8
+)
+
+var (
+	errBadLinkRecord    = errors.New("Bad link record")
+	errExpirationInPast = errors.New("Expiration time is in the past")
+	errBothExpirations  = errors.New("Only one of expires_at and expires_in may be set")
+	errIdNotGenerated   = errors.New("Id generator failed")
+)
+
+// linkRecord is value, saved in storage for every short link.
+//
+// Binary format v2: version byte, creation time, expiration time, url. Times are unix nanoseconds
+// (int64 big endian), zero for empty time.
+// Format v1 is same as v2 without expiration time.
+// Values without version byte (saved before records were introduced) contain plain url only. Urls always start
+// from letter of scheme so they can't be confused with version byte.
+type linkRecord struct {
+	Url       []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+func (r linkRecord) Marshal() []byte {
+	res := make([]byte, linkRecordHeaderLenV2+len(r.Url))
+	res[0] = linkRecordVersion2
+	binary.BigEndian.PutUint64(res[1:], uint64(linkRecordMarshalTime(r.CreatedAt)))
+	binary.BigEndian.PutUint64(res[9:], uint64(linkRecordMarshalTime(r.ExpiresAt)))
+	copy(res[linkRecordHeaderLenV2:], r.Url)
+	return res
+}
+
+// IsExpired return true if link has expiration time and it is before now.
+func (r linkRecord) IsExpired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && r.ExpiresAt.Before(now)
+}
+
+// storageExpireAt return time after which link may be removed from storage. Expired links are kept
+// during expiredRetention for answer 410 Gone instead of 404.
+func (r linkRecord) storageExpireAt() time.Time {
+	if r.ExpiresAt.IsZero() {
+		return time.Time{}
+	}
+	return r.ExpiresAt.Add(*expiredRetention)
+}
+
+func unmarshalLinkRecord(data []byte) (linkRecord, error) {
+	if len(data) == 0 {
+		return linkRecord{}, errBadLinkRecord
+	}
+
+	switch data[0] {
+	case linkRecordVersion1:
+		if len(data) < linkRecordHeaderLenV1 {
+			return linkRecord{}, errBadLinkRecord
+		}
+		return linkRecord{
+			CreatedAt: linkRecordUnmarshalTime(data[1:]),
+			Url:       data[linkRecordHeaderLenV1:],
+		}, nil
+	case linkRecordVersion2:
+		if len(data) < linkRecordHeaderLenV2 {
+			return linkRecord{}, errBadLinkRecord
+		}
+		return linkRecord{
+			CreatedAt: linkRecordUnmarshalTime(data[1:]),
+			ExpiresAt: linkRecordUnmarshalTime(data[9:]),
+			Url:       data[linkRecordHeaderLenV2:],
+		}, nil
+	default:
+		return linkRecord{Url: data}, nil
+	}
+}
+
+func linkRecordMarshalTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func linkRecordUnmarshalTime(data []byte) time.Time {
+	nanoseconds := int64(binary.BigEndian.Uint64(data))
+	if nanoseconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanoseconds).UTC()
+}
+
+// linkOptions are optional parameters of new link
+type linkOptions struct {
+	// Alias used as id of link instead of generated id if not empty
+	Alias []byte
+
+	// ExpiresAt is time after which link answer 410 Gone. Zero for links without expiration.
+	ExpiresAt time.Time
+}
+
+// parseLinkExpiration parse expiration of link from absolute time in RFC3339 format or from duration
+// in time.ParseDuration format. Both are optional, but only one of them may be set.
+func parseLinkExpiration(expiresAt, expiresIn string) (time.Time, error) {
+	switch {
+	case expiresAt != "" && expiresIn != "":
+		return time.Time{}, httpErrBadExpiration.withErr(errBothExpirations)
+	case expiresAt != "":
+		res, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return time.Time{}, httpErrBadExpiration.withErr(err)
+		}
+		return res, nil
+	case expiresIn != "":
+		duration, err := time.ParseDuration(expiresIn)
+		if err != nil {
+			return time.Time{}, httpErrBadExpiration.withErr(err)
+		}
+		return time.Now().Add(duration), nil
+	default:
+		return time.Time{}, nil
+	}
+}
+
+// prepareUrl return normalized url if it can be saved: it is valid and allowed by scheme rules, it isn't link to other shortener, its host
+// isn't blocked and is allowed by destination policy. Short url of this service is handled by ownLinksMode. linkId is id of changed link, nil for new links.
+func prepareUrl(urlBytes, linkId []byte) ([]byte, error) {
+	normalized, err := normalizeUrl(urlBytes)
+	if err != nil {
+		return nil, httpErrBadUrl.withErr(err)
+	}
+	if err = checkUrl(normalized); err != nil {
+		return nil, httpErrBadUrl.withErr(err)
+	}
+	if normalized, err = checkOwnLink(normalized, linkId); err != nil {
+		return nil, err
+	}
+	if err = checkUrlHost(normalized); err != nil {
+		return nil, err
+	}
+	if err = checkDestination(normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// createLink normalize and check url and save it to storage with the alias as id or with generated id if alias is empty.
+func createLink(urlBytes []byte, opts linkOptions) (id []byte, record linkRecord, err error) {
+	urlBytes, err = prepareUrl(urlBytes, nil)
+	if err != nil {
+		return nil, linkRecord{}, err
+	}
+
+	now := time.Now().UTC()
+	if !opts.ExpiresAt.IsZero() && !opts.ExpiresAt.After(now) {
+		return nil, linkRecord{}, httpErrBadExpiration.withErr(errExpirationInPast)
+	}
+	record = linkRecord{Url: urlBytes, CreatedAt: now, ExpiresAt: opts.ExpiresAt.UTC()}
+	value := record.Marshal()
+	storageExpireAt := record.storageExpireAt()
+
+	if len(opts.Alias) > 0 {
+		if err = checkAlias(opts.Alias); err != nil {
+			return nil, linkRecord{}, httpErrBadAlias.withErr(err)
+		}
+		id = aliasKey(opts.Alias)
+		err = storeExpiring(storage, id, value, storageExpireAt)
+		if err == errDuplicate {
+			err = httpErrAliasTaken
+		}
+		if err != nil {
+			return nil, linkRecord{}, err
+		}
+		return id, record, nil
+	}
+
+	if *dedupLinks && opts.ExpiresAt.IsZero() {
+		return createDedupLink(urlBytes, record, value)
+	}
+
+	id, err = storeGeneratedLink(urlBytes, value, storageExpireAt)
+	if err != nil {
+		return nil, linkRecord{}, err
+	}
+	return id, record, nil
+}
+
+// storeGeneratedLink save value with generated id. Id is generated again on any error.
+func storeGeneratedLink(urlBytes, value []byte, storageExpireAt time.Time) (id []byte, err error) {
+	bytesForHash := urlBytes
+	for tryIndex := 0; tryIndex < *maxRetryCount; tryIndex++ {
+		id = hashFunc(bytesForHash)
+		if id == nil {
+			return nil, errIdNotGenerated
+		}
+		err = storeExpiring(storage, id, value, storageExpireAt)
+		if err == nil {
+			return id, nil
+		}
+
+		bytesForHash = id
+	}
+	return nil, err
+}
+
+type createLinkResult struct {
+	Id     []byte
+	Record linkRecord
+	Err    error
+}
+
+// createLinks do same as createLink for many urls, items are saved to storage by batches.
+// Error of one item doesn't affect other items.
+func createLinks(urls [][]byte) []createLinkResult {
+	results := make([]createLinkResult, len(urls))
+	if *dedupLinks {
+		// reverse index is checked for every url
+		for i, urlBytes := range urls {
+			results[i].Id, results[i].Record, results[i].Err = createLink(urlBytes, linkOptions{})
+		}
+		return results
+	}
+
+	values := make([][]byte, len(urls))
+	bytesForHash := make([][]byte, len(urls))
+	createdAt := time.Now().UTC()
+
+	pending := make([]int, 0, len(urls))
+	for i, urlBytes := range urls {
+		urlBytes, err := prepareUrl(urlBytes, nil)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Record = linkRecord{Url: urlBytes, CreatedAt: createdAt}
+		values[i] = results[i].Record.Marshal()
+		bytesForHash[i] = urlBytes
+		pending = append(pending, i)
+	}
+
+	for tryIndex := 0; tryIndex < *maxRetryCount && len(pending) > 0; tryIndex++ {
+		keys := make([][]byte, 0, len(pending))
+		batchValues := make([][]byte, 0, len(pending))
+		batchPending := pending[:0]
+		for _, itemIndex := range pending {
+			key := hashFunc(bytesForHash[itemIndex])
+			if key == nil {
+				results[itemIndex].Err = errIdNotGenerated
+				continue
+			}
+			keys = append(keys, key)
+			batchValues = append(batchValues, values[itemIndex])
+			batchPending = append(batchPending, itemIndex)
+		}
+		pending = batchPending
+		if len(pending) == 0 {
+			break
+		}
+
+		errs := storeBatch(storage, keys, batchValues)
+
+		nextPending := pending[:0]
+		for batchIndex, itemIndex := range pending {
+			if errs[batchIndex] == nil {
+				results[itemIndex].Id = keys[batchIndex]
+				results[itemIndex].Err = nil
+				continue
+			}
+			results[itemIndex].Err = errs[batchIndex]
+			bytesForHash[itemIndex] = keys[batchIndex]
+			nextPending = append(nextPending, itemIndex)
+		}
+		pending = nextPending
+	}
+	return results
+}
+
+// decodeLinkId decode id (or alias) from url to storage key
+func decodeLinkId(encodedId []byte) (id []byte, err error) {
+	if isMistypedIdLen(len(encodedId)) {
+		idCheckFailures.Add(1)
+		return nil, httpErrBadId.withErr(errIdSymbolMissedOrExtra)
+	}
+	if !isEncodedIdLen(len(encodedId)) {
+		if err = checkAlias(encodedId); err != nil {
+			return nil, httpErrBadId.withErr(err)
+		}
+		return aliasKey(encodedId), nil
+	}
+
+	id, err = idEncoding.Decode(encodedId)
+	if err == errBadIdCheckChar {
+		idCheckFailures.Add(1)
+	}
+	if err != nil || len(id) != idLength {
+		return nil, httpErrBadId.withErr(err)
+	}
+	return id, nil
+}
+
+// findLink decode id (or alias) from url and load link from storage
+func findLink(encodedId []byte) (id []byte, record linkRecord, err error) {
+	id, err = decodeLinkId(encodedId)
+	if err != nil {
+		return nil, linkRecord{}, err
+	}
+
+	value, err := storage.Get(id)
+	if err != nil {
+		return nil, linkRecord{}, err
+	}
+	record, err = unmarshalLinkRecord(value)
+	if err != nil {
+		return nil, linkRecord{}, httpErrInternal.withErr(err)
+	}
+	if record.IsExpired(time.Now()) {
+		return nil, linkRecord{}, httpErrGone
+	}
+	return id, record, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+//nolint:deadcode,megacheck
+func TestLinkRecord_Marshal(t *testing.T) {
+	record := linkRecord{Url: []byte("http://example.com"), CreatedAt: time.Unix(1500000000, 123).UTC()}
+	res, err := unmarshalLinkRecord(record.Marshal())
+	if err != nil || string(res.Url) != "http://example.com" || !res.CreatedAt.Equal(record.CreatedAt) {
+		t.Error(err, res)
+	}
+
+	res, err = unmarshalLinkRecord(linkRecord{Url: []byte("http://example.com")}.Marshal())
+	if err != nil || string(res.Url) != "http://example.com" || !res.CreatedAt.IsZero() {
+		t.Error(err, res)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestLinkRecord_MarshalExpiration(t *testing.T) {
+	record := linkRecord{
+		Url:       []byte("http://example.com"),
+		CreatedAt: time.Unix(1500000000, 0).UTC(),
+		ExpiresAt: time.Unix(1600000000, 0).UTC(),
+	}
+	res, err := unmarshalLinkRecord(record.Marshal())
+	if err != nil || string(res.Url) != "http://example.com" || !res.CreatedAt.Equal(record.CreatedAt) ||
+		!res.ExpiresAt.Equal(record.ExpiresAt) {
+		t.Error(err, res)
+	}
+
+	if res.IsExpired(time.Unix(1599999999, 0)) || !res.IsExpired(time.Unix(1600000001, 0)) {
+		t.Error("Bad expiration")
+	}
+	if (linkRecord{}).IsExpired(time.Now()) {
+		t.Error("Link without expiration is expired")
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestLinkRecord_UnmarshalV1(t *testing.T) {
+	data := append([]byte{linkRecordVersion1, 0, 0, 0, 0, 0, 0, 0, 1}, "http://example.com"...)
+	res, err := unmarshalLinkRecord(data)
+	if err != nil || string(res.Url) != "http://example.com" || !res.CreatedAt.Equal(time.Unix(0, 1)) ||
+		!res.ExpiresAt.IsZero() {
+		t.Error(err, res)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestLinkRecord_UnmarshalPlainUrl(t *testing.T) {
+	res, err := unmarshalLinkRecord([]byte("http://example.com"))
+	if err != nil || string(res.Url) != "http://example.com" || !res.CreatedAt.IsZero() {
+		t.Error(err, res)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestLinkRecord_UnmarshalBad(t *testing.T) {
+	for _, data := range [][]byte{nil, {linkRecordVersion1, 1, 2}, {linkRecordVersion2, 1, 2, 3, 4, 5, 6, 7, 8, 9}} {
+		if _, err := unmarshalLinkRecord(data); err != errBadLinkRecord {
+			t.Error(data, err)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestParseLinkExpiration(t *testing.T) {
+	res, err := parseLinkExpiration("", "")
+	if err != nil || !res.IsZero() {
+		t.Error(err, res)
+	}
+
+	res, err = parseLinkExpiration("2030-01-02T03:04:05Z", "")
+	if err != nil || !res.Equal(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Error(err, res)
+	}
+
+	start := time.Now()
+	res, err = parseLinkExpiration("", "1h")
+	if err != nil || res.Before(start.Add(time.Hour)) || res.After(time.Now().Add(time.Hour)) {
+		t.Error(err, res)
+	}
+
+	for _, test := range [][2]string{{"2030-01-02", ""}, {"", "1 day"}, {"2030-01-02T03:04:05Z", "1h"}} {
+		if _, err = parseLinkExpiration(test[0], test[1]); toHttpError(err).Code != "bad_expiration" {
+			t.Error(test, err)
+		}
+	}
+}
@@ -3,10 +3,15 @@ package main
 import (
 	"bytes"
 	cryptorand "crypto/rand"
+	"expvar"
 	"flag"
+	"io"
 	"math/rand"
 	"net/http"
-	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/valyala/fasthttp"
 
@@ -21,26 +26,89 @@ const (
 )
 
 var (
-	storage         Storage     = nil
-	hashFunc        HashFunc    = hashRandom_48Bit
-	makeUrl         MakeUrlFunc = encodeUrlBase64
-	hashDecoderFunc IdDecoder   = decodeUrlBase64
+	storage    Storage  = nil
+	hashFunc   HashFunc = hashRandom_48Bit
+	idEncoding          = IdEncoding{Alphabet: base64Alphabet, Encode: encodeUrlBase64, Decode: decodeUrlBase64}
+
+	// idLength is length of ids, generated by hashFunc, in bytes. hashFunc, idEncoding and idLength
+	// are set by setupIds from flags.
+	idLength = 6
+
+	rootPath = []byte("/")
+
+	// clicks is nil if click counting is disabled or not supported by storage
+	clicks *clickCounter
 )
 
 func main() {
 	flag.Parse()
 	urlPrefixBytes = []byte(*urlPrefix)
+	if err := setupOwnLinks(*urlPrefix, *ownUrlPrefixesList, *ownLinks, *shortenerDomainsList); err != nil {
+		log.Fatal(err)
+	}
 	randIntSeed, err := cryptorand.Int(cryptorand.Reader, big.NewInt(math.MaxInt64))
 	if err != nil {
 		panic(err)
 	}
 	rand.Seed(randIntSeed.Int64())
 
+	sipHashKeys, err = loadSipHashKeys(*sipHashKeysFile, os.Getenv(sipHashKeysEnv))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := checkSipHashKeys(*idGeneratorName, sipHashKeys, *sipHashAllowDefaultKey); err != nil {
+		log.Fatal(err)
+	}
+	if err := setupUrlSchemes(*urlSchemesList, *maxUrlLengthFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := setupDestinationPolicy(*destinationPolicyName, *destinationResolveTimeoutFlag); err != nil {
+		log.Fatal(err)
+	}
+	if *hostRulesFileName != "" {
+		hostRulesList, err = loadHostRulesFile(*hostRulesFileName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go hostRulesList.Run(*hostRulesCheckInterval)
+	}
+	if !allowedRedirectCodes[*redirectCode] {
+		log.Fatalf("Unsupported redirect code: %v", *redirectCode)
+	}
+	if err := checkStorageCacheLimits(*cacheEntries, *cacheBytes); err != nil {
+		log.Fatal(err)
+	}
+
 	switch *storageType {
 	case "files":
-		storage = NewStorageFiles(*storeFolder)
+		s := NewStorageFiles(*storeFolder)
+		s.Fsync = *storeFsync
+		if *storeMigrate {
+			count, err := s.MigrateFlat()
+			log.Printf("Moved to subdirectories: %v", count)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		storage = s
 	case "memory-map":
-		storage = NewStorageMap()
+		if *mapSnapshotFile == "" {
+			storage = NewStorageMap()
+			break
+		}
+		m := NewStorageMapPersistent(*mapSnapshotFile, *mapJournalFile, *mapJournalFsync)
+		go m.RunSnapshots(*mapSnapshotInterval)
+		go closeOnSignal(m)
+		storage = m
+	case "sharded-map":
+		storage = NewStorageShardedMap(*mapShards)
+	case "log":
+		l := NewStorageLog(*logFile, *logFsync)
+		defer l.Close()
+		go l.RunCompaction(*logCompactInterval)
+		go closeOnSignal(l)
+		storage = l
 	case "tarantool":
 		t := NewStorageTarantool(*tarantoolServer, *tarantoolUser, *tarantoolPassword, *tarantoolSpace)
 		defer t.Close()
@@ -51,82 +119,140 @@ func main() {
 		log.Fatalf("Unknown type of storage: '%v'", *storageType)
 	}
 
-	if err := fasthttp.ListenAndServe(*bindAddress, handleRequest); err != nil {
+	// counter is kept by storage if it can share counter between instances
+	if *idGeneratorName == "counter" {
+		if counterStorage, ok := storage.(CounterStorage); ok {
+			idCounterSource = counterStorage
+		} else {
+			idCounterSource = NewCounterFile(*counterFile)
+		}
+	}
+	if err := setupIds(*idGeneratorName, *idEncodingName, *idLengthFlag); err != nil {
+		log.Fatal(err)
+	}
+
+	// cache implements all optional interfaces, check abilities of backend before wrap
+	_, isExpiringStorage := storage.(ExpiringStorage)
+	_, isClickStorage := storage.(ClickStorage)
+	if t, ok := storage.(*StorageTarantool); ok && !t.HasStats() {
+		isClickStorage = false
+	}
+	if *cacheEntries > 0 {
+		cache := NewStorageCache(storage, *cacheEntries, *cacheBytes, *cacheNegativeTTL)
+		expvar.Publish("storage_cache", expvar.Func(func() interface{} { return cache.Stats() }))
+		storage = cache
+	}
+
+	if isExpiringStorage {
+		go runExpiredSweeper(storage.(ExpiringStorage), *expiredSweepInterval)
+	}
+	if isClickStorage && *clickFlushInterval > 0 {
+		clicks = newClickCounter(storage.(ClickStorage))
+		go clicks.Run(*clickFlushInterval)
+	}
+
+	maxBodySize, readBufferSize := requestLimits(maxUrlLength, *maxBatchSize)
+	server := &fasthttp.Server{
+		Handler:            handleRequest,
+		MaxRequestBodySize: maxBodySize,
+		ReadBufferSize:     readBufferSize,
+	}
+	if err := server.ListenAndServe(*bindAddress); err != nil {
 		log.Println(err)
 	}
 }
 
+// closeOnSignal close storage and exit on SIGINT or SIGTERM, for storages which save data on close
+func closeOnSignal(c io.Closer) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	log.Printf("Got signal %v, close storage", sig)
+	if clicks != nil {
+		if err := clicks.Flush(); err != nil {
+			log.Printf("Can't save clicks: %v", err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		log.Fatalf("Can't close storage: %v", err)
+	}
+	os.Exit(0)
+}
+
 func handleRequest(ctx *fasthttp.RequestCtx) {
-	addrBytes := ctx.FormValue("url")
-	if len(addrBytes) > 0 {
-		handlreStoreRequest(ctx, addrBytes)
-	} else {
+	path := ctx.Path()
+	switch {
+	case bytes.HasPrefix(path, apiLinksPath):
+		handleApiLinksRequest(ctx)
+	case bytes.HasPrefix(path, adminPath):
+		handleAdminRequest(ctx)
+	case bytes.Equal(path, rootPath) || len(ctx.FormValue("url")) > 0:
+		// compatibility interface: store url from form value on any path, as before the api
+		handlreStoreRequest(ctx, ctx.FormValue("url"))
+	case ctx.IsGet() || ctx.IsHead():
 		handleReadRequest(ctx)
+	default:
+		ctx.Response.Header.Set("Allow", "GET, HEAD")
+		writeHttpError(ctx, httpErrMethodNotAllowed)
 	}
 }
 
+var allowedRedirectCodes = map[int]bool{
+	http.StatusMovedPermanently:  true,
+	http.StatusFound:             true,
+	http.StatusTemporaryRedirect: true,
+	http.StatusPermanentRedirect: true,
+}
+
+// handleReadRequest redirects client to stored url.
+// With query parameter "plain" it returns the url as text body instead of redirect (for tools).
 func handleReadRequest(ctx *fasthttp.RequestCtx) {
 	ctx.SetContentType("text/plain")
-	encodedId := ctx.Request.RequestURI()
-	if len(encodedId) < 2 {
-		ctx.SetStatusCode(http.StatusBadRequest)
+	id, record, err := findLink(ctx.Path()[1:])
+	if err != nil {
+		writeHttpError(ctx, err)
 		return
 	}
-
-	encodedId = encodedId[1:]
-
-	binaryId, err := hashDecoderFunc(encodedId)
-	if err != nil {
-		ctx.SetStatusCode(http.StatusBadRequest)
-		if _, err := ctx.WriteString(err.Error()); err != nil {
-			ctx.SetStatusCode(http.StatusInternalServerError)
-		}
+	// rules may be changed after the link was saved
+	if err = checkUrlHost(record.Url); err != nil {
+		writeBlockedUrlPage(ctx, record.Url, err)
 		return
 	}
+	if clicks != nil {
+		clicks.Hit(id, time.Now())
+	}
 
-	destUrl, err := storage.Get(binaryId)
-	if err != nil {
-		ctx.SetStatusCode(http.StatusInternalServerError)
-		if _, err := ctx.WriteString(err.Error()); err != nil {
-			ctx.SetStatusCode(http.StatusInternalServerError)
-			return
-		}
+	if !ctx.QueryArgs().Has("plain") {
+		// fasthttp RequestCtx.Redirect doesn't support 308, set header directly
+		ctx.Response.Header.SetBytesV("Location", record.Url)
+		ctx.SetStatusCode(*redirectCode)
+		return
 	}
+
 	ctx.SetStatusCode(http.StatusOK)
-	if _, err := ctx.Write(destUrl); err != nil {
+	if _, err := ctx.Write(record.Url); err != nil {
 		ctx.SetStatusCode(http.StatusInternalServerError)
 		return
 	}
 }
 
 func handlreStoreRequest(ctx *fasthttp.RequestCtx, urlBytes []byte) {
-	ctx.SetContentType("text/plain")
-	if !checkUrl(urlBytes) {
-		ctx.Response.SetStatusCode(http.StatusBadRequest)
+	expiresAt, err := parseLinkExpiration(string(ctx.FormValue("expires_at")), string(ctx.FormValue("expires_in")))
+	if err != nil {
+		writeHttpError(ctx, err)
 		return
 	}
-
-	bytesForHash := urlBytes
-	var resultUrl []byte
-	var saveErr error
-	for tryIndex := 0; tryIndex < *maxRetryCount; tryIndex++ {
-		urlHash := hashFunc(bytesForHash)
-		saveErr = storage.Store(urlHash, urlBytes)
-		if saveErr == nil {
-			resultUrl = makeUrl(urlPrefixBytes, urlHash)
-			break
-		}
-
-		bytesForHash = urlHash
+	opts := linkOptions{
+		Alias:     ctx.FormValue("alias"),
+		ExpiresAt: expiresAt,
 	}
-	if saveErr != nil {
-		ctx.SetStatusCode(http.StatusInternalServerError)
-		if _, err := ctx.WriteString(saveErr.Error()); err != nil {
-			ctx.SetStatusCode(http.StatusInternalServerError)
-			return
-		}
+
+	id, _, err := createLink(urlBytes, opts)
+	if err != nil {
+		writeHttpError(ctx, err)
 		return
 	}
+	resultUrl := makeLinkUrl(urlPrefixBytes, id)
 	ctx.Response.SetStatusCode(http.StatusOK)
 	ctx.SetContentType("text/plain")
 	if _, err := ctx.Write(resultUrl); err != nil {
@@ -134,37 +260,3 @@ func handlreStoreRequest(ctx *fasthttp.RequestCtx, urlBytes []byte) {
 		return
 	}
 }
-
-var checkUrlAllowedPrefixes = [][]byte{
-	[]byte("http://"),
-	[]byte("https://"),
-	[]byte("ftp://"),
-}
-
-func checkUrl(urlBytes []byte) bool {
-	if len(urlBytes) == 0 || len(urlBytes) > 3000 {
-		return false
-	}
-
-	hasAllowedPrefix := false
-	for _, prefix := range checkUrlAllowedPrefixes {
-		if bytes.HasPrefix(urlBytes, prefix) {
-			hasAllowedPrefix = true
-			break
-		}
-	}
-	if !hasAllowedPrefix {
-		return false
-	}
-
-	parsedUrl, err := url.Parse(string(urlBytes))
-	if err != nil {
-		return false
-	}
-
-	if parsedUrl.Host == "" || parsedUrl.Scheme == "" {
-		return false
-	}
-
-	return true
-}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+//nolint:deadcode,megacheck
+func handlerTestInit() {
+	storage = NewStorageMap()
+	urlPrefixBytes = []byte("http://sho.rt/")
+	*redirectCode = http.StatusFound
+	clicks = nil
+	idCounterSource = nil
+	*idCheckChar = false
+	hostRulesList = nil
+	destinationResolver = net.DefaultResolver
+	if err := setupDestinationPolicy(destinationPublicIp, time.Second); err != nil {
+		panic(err)
+	}
+	if err := setupOwnLinks("http://sho.rt/", "", ownLinksReject, ""); err != nil {
+		panic(err)
+	}
+	if err := setupUrlSchemes("http,https,ftp", 3000); err != nil {
+		panic(err)
+	}
+	if err := setupIds("random", "base64", 6); err != nil {
+		panic(err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func handlerTestRequest(method, uri string) *fasthttp.RequestCtx {
+	return handlerTestRequestBody(method, uri, nil)
+}
+
+//nolint:deadcode,megacheck
+func handlerTestRequestBody(method, uri string, body []byte) *fasthttp.RequestCtx {
+	var req fasthttp.Request
+	req.Header.SetMethod(method)
+	req.SetRequestURI(uri)
+	req.SetBody(body)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, nil, nil)
+	handleRequest(&ctx)
+	return &ctx
+}
+
+//nolint:deadcode,megacheck
+func handlerTestStore(t *testing.T, longUrl string) (encodedId string) {
+	ctx := handlerTestRequest("GET", "/?url="+longUrl)
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatal(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+	shortUrl := string(ctx.Response.Body())
+	return shortUrl[len(urlPrefixBytes):]
+}
+
+//nolint:deadcode,megacheck
+func TestHandleReadRequest_Redirect(t *testing.T) {
+	handlerTestInit()
+	id := handlerTestStore(t, "http://example.com/page")
+
+	for _, code := range []int{http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect} {
+		*redirectCode = code
+		ctx := handlerTestRequest("GET", "/"+id)
+		if ctx.Response.StatusCode() != code {
+			t.Error(code, ctx.Response.StatusCode())
+		}
+		location := string(ctx.Response.Header.Peek("Location"))
+		if location != "http://example.com/page" {
+			t.Error(code, location)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestHandleReadRequest_Plain(t *testing.T) {
+	handlerTestInit()
+	id := handlerTestStore(t, "http://example.com/page")
+
+	ctx := handlerTestRequest("GET", "/"+id+"?plain")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Error(ctx.Response.StatusCode())
+	}
+	if body := string(ctx.Response.Body()); body != "http://example.com/page" {
+		t.Error(body)
+	}
+	if location := ctx.Response.Header.Peek("Location"); len(location) != 0 {
+		t.Error(string(location))
+	}
+}
+
+type storageFailing struct{}
+
+func (storageFailing) Store(key, value []byte) error {
+	return errors.New("test backend failure")
+}
+
+func (storageFailing) Get(key []byte) ([]byte, error) {
+	return nil, errors.New("test backend failure")
+}
+
+//nolint:deadcode,megacheck
+func TestHandleReadRequest_Errors(t *testing.T) {
+	handlerTestInit()
+
+	table := []struct {
+		uri    string
+		status int
+		code   string
+	}{
+		{"/", http.StatusBadRequest, "bad_url"},
+		{"/a", http.StatusBadRequest, "bad_id"},
+		{"/$$$$", http.StatusBadRequest, "bad_id"},
+		{"/AAAAAAAA", http.StatusNotFound, "not_found"},
+	}
+	for _, test := range table {
+		ctx := handlerTestRequest("GET", test.uri)
+		if ctx.Response.StatusCode() != test.status {
+			t.Error(test.uri, ctx.Response.StatusCode())
+		}
+		if code := string(ctx.Response.Header.Peek("X-Error-Code")); code != test.code {
+			t.Error(test.uri, code)
+		}
+		if location := ctx.Response.Header.Peek("Location"); len(location) != 0 {
+			t.Error(test.uri, string(location))
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestHandleReadRequest_StorageUnavailable(t *testing.T) {
+	handlerTestInit()
+	storage = storageFailing{}
+
+	ctx := handlerTestRequest("GET", "/AAAAAAAA")
+	if ctx.Response.StatusCode() != http.StatusServiceUnavailable {
+		t.Error(ctx.Response.StatusCode())
+	}
+	if code := string(ctx.Response.Header.Peek("X-Error-Code")); code != "storage_unavailable" {
+		t.Error(code)
+	}
+	if retryAfter := string(ctx.Response.Header.Peek("Retry-After")); retryAfter != strconv.Itoa(*storageRetryAfter) {
+		t.Error(retryAfter)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestHandleStoreRequest_Errors(t *testing.T) {
+	handlerTestInit()
+	ctx := handlerTestRequest("GET", "/?url=bad-url")
+	if ctx.Response.StatusCode() != http.StatusBadRequest ||
+		string(ctx.Response.Header.Peek("X-Error-Code")) != "bad_url" {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	storage = storageFailing{}
+	ctx = handlerTestRequest("GET", "/?url=http://example.com")
+	if ctx.Response.StatusCode() != http.StatusServiceUnavailable ||
+		string(ctx.Response.Header.Peek("X-Error-Code")) != "storage_unavailable" {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestHandleStoreRequest_LegacyRoutes(t *testing.T) {
+	handlerTestInit()
+
+	formBody := func(method, uri, body string) *fasthttp.RequestCtx {
+		var req fasthttp.Request
+		req.Header.SetMethod(method)
+		req.Header.SetContentType("application/x-www-form-urlencoded")
+		req.SetRequestURI(uri)
+		req.SetBodyString(body)
+
+		var ctx fasthttp.RequestCtx
+		ctx.Init(&req, nil, nil)
+		handleRequest(&ctx)
+		return &ctx
+	}
+
+	for _, ctx := range []*fasthttp.RequestCtx{
+		handlerTestRequest("GET", "/?url=http://example.com/legacy"),
+		handlerTestRequest("GET", "/store?url=http://example.com/legacy"),
+		handlerTestRequest("GET", "/?utm=1&url=http://example.com/legacy"),
+		formBody("POST", "/", "url=http://example.com/legacy"),
+		formBody("POST", "/shorten", "url=http://example.com/legacy"),
+	} {
+		uri := string(ctx.Request.RequestURI())
+		if ctx.Response.StatusCode() != http.StatusOK {
+			t.Error(uri, ctx.Response.StatusCode(), string(ctx.Response.Body()))
+			continue
+		}
+		id := string(ctx.Response.Body()[len(urlPrefixBytes):])
+		read := handlerTestRequest("GET", "/"+id)
+		if location := string(read.Response.Header.Peek("Location")); location != "http://example.com/legacy" {
+			t.Error(uri, id, location)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestHandleRequest_MethodNotAllowed(t *testing.T) {
+	handlerTestInit()
+	ctx := handlerTestRequest("POST", "/AAAAAAAA")
+	if ctx.Response.StatusCode() != http.StatusMethodNotAllowed {
+		t.Error(ctx.Response.StatusCode())
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestHandleRequest_Expiration(t *testing.T) {
+	handlerTestInit()
+
+	ctx := handlerTestRequest("GET", "/?url=http://example.com/promo&expires_in=1h")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatal(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+	ctx = handlerTestRequest("GET", "/"+string(ctx.Response.Body()[len(urlPrefixBytes):]))
+	if ctx.Response.StatusCode() != http.StatusFound {
+		t.Error(ctx.Response.StatusCode())
+	}
+
+	ctx = handlerTestRequest("GET", "/?url=http://example.com/promo&expires_at=2000-01-01T00:00:00Z")
+	if ctx.Response.StatusCode() != http.StatusBadRequest ||
+		string(ctx.Response.Header.Peek("X-Error-Code")) != "bad_expiration" {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+
+	expired := linkRecord{Url: []byte("http://example.com/old"), ExpiresAt: time.Now().Add(-time.Second)}
+	if err := storage.Store([]byte("123456"), expired.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	ctx = handlerTestRequest("GET", "/"+string(idEncoding.Encode(nil, []byte("123456"))))
+	if ctx.Response.StatusCode() != http.StatusGone ||
+		string(ctx.Response.Header.Peek("X-Error-Code")) != "expired" {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+}
@@ -1,18 +1,36 @@
 package main
 
 import (
+	"bytes"
 	"encoding/base32"
 	"encoding/base64"
+	"errors"
 	"math/big"
 )
 
 type MakeUrlFunc func(prefix, id []byte) (url []byte)
 type IdDecoder func(urlHash []byte) ([]byte, error)
 
-//nolint:deadcode,megacheck
-var base32Encoding = base32.NewEncoding("ABCDEFGHJKLMNPQRSTUVWXYZ-2345679").WithPadding(base32.NoPadding)
+var (
+	errNonCanonicalId = errors.New("Id isn't in canonical encoding")
+	errBadIdLength    = errors.New("Bad length of encoded id")
+	errBadIdSymbol    = errors.New("Bad symbol in encoded id")
+)
+
+const (
+	base32Alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ-2345679"
+	base62Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+	// readableAlphabet is Crockford's base32 alphabet: without I, L, O and U
+	readableAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+var (
+	base32Encoding   = base32.NewEncoding(base32Alphabet).WithPadding(base32.NoPadding)
+	readableEncoding = base32.NewEncoding(readableAlphabet).WithPadding(base32.NoPadding)
+)
 
-//nolint:deadcode,megacheck
 func encodeUrlBase32(prefix, val []byte) []byte {
 	resLen := base32Encoding.EncodedLen(len(val))
 	res := make([]byte, resLen+len(prefix))
@@ -29,19 +47,163 @@ func encodeUrlBase64(prefix, val []byte) []byte {
 	return res
 }
 
+// decodeUrlBase64 accept canonical encoding only: unused bits of last symbol must be zero.
 func decodeUrlBase64(val []byte) ([]byte, error) {
 	maxLen := base64.RawURLEncoding.DecodedLen(len(val))
 	res := make([]byte, maxLen)
-	realLen, err := base64.RawURLEncoding.Decode(res, val)
+	realLen, err := base64.RawURLEncoding.Strict().Decode(res, val)
 	if err != nil {
 		return nil, err
 	}
 	return res[:realLen], nil
 }
 
-//nolint:deadcode,megacheck
+// decodeUrlBase32 accept canonical encoding only: unused bits of last symbol must be zero, so every id has one
+// short url.
+func decodeUrlBase32(val []byte) ([]byte, error) {
+	res := make([]byte, base32Encoding.DecodedLen(len(val)))
+	realLen, err := base32Encoding.Decode(res, val)
+	if err != nil {
+		return nil, err
+	}
+	res = res[:realLen]
+	if !bytes.Equal(encodeUrlBase32(nil, res), val) {
+		return nil, errNonCanonicalId
+	}
+	return res, nil
+}
+
+func encodeUrlReadable(prefix, val []byte) []byte {
+	resLen := readableEncoding.EncodedLen(len(val))
+	res := make([]byte, resLen+len(prefix))
+	copy(res, prefix)
+	readableEncoding.Encode(res[len(prefix):], val)
+	return res
+}
+
+// normalizeReadableSymbol return symbol of readableAlphabet for symbol, typed by human: lower case letters are same
+// as upper case, O is same as 0, I and L are same as 1. Other symbols are returned as is.
+func normalizeReadableSymbol(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	switch c {
+	case 'O':
+		return '0'
+	case 'I', 'L':
+		return '1'
+	default:
+		return c
+	}
+}
+
+// decodeUrlReadable accept ids in any case and with ambiguous symbols, but unused bits of last symbol
+// must be zero.
+func decodeUrlReadable(val []byte) ([]byte, error) {
+	normalized := make([]byte, len(val))
+	for i, c := range val {
+		normalized[i] = normalizeReadableSymbol(c)
+	}
+
+	res := make([]byte, readableEncoding.DecodedLen(len(normalized)))
+	realLen, err := readableEncoding.Decode(res, normalized)
+	if err != nil {
+		return nil, err
+	}
+	res = res[:realLen]
+	if !bytes.Equal(encodeUrlReadable(nil, res), normalized) {
+		return nil, errNonCanonicalId
+	}
+	return res, nil
+}
+
+// encodeUrlBase62 encode id as big-endian number, padded by leading zeroes to same length for all ids
+// of same length.
 func encodeUrlBase62(prefix, val []byte) []byte {
 	bigInt := big.Int{}
 	bigInt.SetBytes(val)
-	return bigInt.Append(prefix, 62)
+	digits := bigInt.Text(62)
+
+	resLen := base62EncodedLen(len(val))
+	res := make([]byte, len(prefix)+resLen)
+	copy(res, prefix)
+	for i := len(prefix); i < len(res)-len(digits); i++ {
+		res[i] = '0'
+	}
+	copy(res[len(res)-len(digits):], digits)
+	return res
+}
+
+func decodeUrlBase62(val []byte) ([]byte, error) {
+	length := 0
+	for base62EncodedLen(length) < len(val) {
+		length++
+	}
+	if base62EncodedLen(length) != len(val) {
+		return nil, errBadIdLength
+	}
+	for _, c := range val {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return nil, errBadIdSymbol
+		}
+	}
+
+	bigInt := big.Int{}
+	if _, ok := bigInt.SetString(string(val), 62); !ok || bigInt.BitLen() > 8*length {
+		return nil, errBadIdSymbol
+	}
+	res := make([]byte, length)
+	digits := bigInt.Bytes()
+	copy(res[length-len(digits):], digits)
+	return res, nil
+}
+
+var base62EncodedLens = func() []int {
+	res := make([]int, 65)
+	for i := range res {
+		res[i] = calcBase62EncodedLen(i)
+	}
+	return res
+}()
+
+// base62EncodedLen return length of encoded id: count of base62 digits for max number of length bytes
+func base62EncodedLen(length int) int {
+	if length < len(base62EncodedLens) {
+		return base62EncodedLens[length]
+	}
+	return calcBase62EncodedLen(length)
+}
+
+func calcBase62EncodedLen(length int) int {
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(8*length))
+	base := big.NewInt(62)
+	res := 0
+	for power := big.NewInt(1); power.Cmp(limit) < 0; power.Mul(power, base) {
+		res++
+	}
+	return res
+}
+
+// IdEncoding convert ids to text for short urls and back
+type IdEncoding struct {
+	// Alphabet is symbols of encoded ids, index of symbol is its value for check character
+	Alphabet string
+	Encode   MakeUrlFunc
+	Decode   IdDecoder
+
+	// Normalize return symbol of Alphabet for other symbols, accepted by Decode. Nil if Decode accept
+	// symbols of Alphabet only.
+	Normalize func(c byte) byte
+
+	// CheckChar is true if check character is added after encoded id
+	CheckChar bool
+}
+
+// idEncodings is registry of encodings, selectable by -id-encoding flag
+var idEncodings = map[string]IdEncoding{
+	"base32": {Alphabet: base32Alphabet, Encode: encodeUrlBase32, Decode: decodeUrlBase32},
+	"base62": {Alphabet: base62Alphabet, Encode: encodeUrlBase62, Decode: decodeUrlBase62},
+	"base64": {Alphabet: base64Alphabet, Encode: encodeUrlBase64, Decode: decodeUrlBase64},
+	"readable": {Alphabet: readableAlphabet, Encode: encodeUrlReadable, Decode: decodeUrlReadable,
+		Normalize: normalizeReadableSymbol},
 }
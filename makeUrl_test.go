@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+//nolint:deadcode,megacheck
+func TestIdEncodings_RoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for name, encoding := range idEncodings {
+		for length := 1; length <= 32; length++ {
+			encodedLen := len(encoding.Encode(nil, make([]byte, length)))
+			for i := 0; i < 200; i++ {
+				id := make([]byte, length)
+				r.Read(id)
+				// leading zeroes
+				for j := 0; j < i%4 && j < length; j++ {
+					id[j] = 0
+				}
+
+				encoded := encoding.Encode([]byte("prefix/"), id)
+				if !bytes.HasPrefix(encoded, []byte("prefix/")) || len(encoded) != len("prefix/")+encodedLen {
+					t.Fatal(name, length, string(encoded))
+				}
+				decoded, err := encoding.Decode(encoded[len("prefix/"):])
+				if err != nil || !bytes.Equal(decoded, id) {
+					t.Fatal(name, length, id, string(encoded), decoded, err)
+				}
+			}
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestIdEncodings_DecodeErrors(t *testing.T) {
+	table := []struct {
+		encoding string
+		encoded  string
+	}{
+		{"base64", "AAAAAAB"},    // unused bits aren't zero
+		{"base64", "AAAA$AAA"},   // bad symbol
+		{"base32", "AAAAAAAAAB"}, // unused bits aren't zero
+		{"base32", "AAAAAAAAA0"}, // bad symbol
+		{"base62", "0000"},       // length of no id
+		{"base62", "zzzzzzzzz"},  // more than 6 bytes
+		{"base62", "+00000000"},
+		{"base62", "0000_0000"},
+		{"readable", "0000000001"}, // unused bits aren't zero
+		{"readable", "000000000U"}, // bad symbol
+		{"readable", "0000-00000"},
+	}
+	for _, test := range table {
+		if res, err := idEncodings[test.encoding].Decode([]byte(test.encoded)); err == nil {
+			t.Error(test, res)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestEncodeUrlBase62_LeadingZeroes(t *testing.T) {
+	if res := string(encodeUrlBase62(nil, []byte{0, 0, 0, 0, 0, 1})); res != "000000001" {
+		t.Error(res)
+	}
+	if res, err := decodeUrlBase62([]byte("000000001")); err != nil || !bytes.Equal(res, []byte{0, 0, 0, 0, 0, 1}) {
+		t.Error(res, err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestDecodeUrlReadable_HumanInput(t *testing.T) {
+	id := []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab}
+	encoded := string(encodeUrlReadable(nil, id))
+	if encoded != "04HMASW9NC" {
+		t.Fatal(encoded)
+	}
+	for _, typed := range []string{"04hmasw9nc", "O4HMASW9NC", "o4HmAsW9nC"} {
+		if res, err := decodeUrlReadable([]byte(typed)); err != nil || !bytes.Equal(res, id) {
+			t.Error(typed, res, err)
+		}
+	}
+
+	id = []byte{0x08, 0x42, 0x10, 0x84, 0x21}
+	if encoded := string(encodeUrlReadable(nil, id)); encoded != "11111111" {
+		t.Fatal(encoded)
+	}
+	for _, typed := range []string{"11111111", "IiLl1IlL"} {
+		if res, err := decodeUrlReadable([]byte(typed)); err != nil || !bytes.Equal(res, id) {
+			t.Error(typed, res, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// defaultPorts are removed from normalized urls
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// normalizeUrl return canonical form of url (RFC 3986, section 6): scheme and host in lower case, IDN host
+// in punycode, host without trailing dot, without default port and empty fragment, without dot segments in path.
+// Percent-encoding use upper case hex digits, unreserved symbols are decoded.
+// Same links are stored, deduplicated and checked by rules in normalized form only.
+func normalizeUrl(urlBytes []byte) ([]byte, error) {
+	u, err := url.Parse(string(urlBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if u.Opaque != "" {
+		u.Scheme = scheme
+		return []byte(u.String()), nil
+	}
+
+	var buf bytes.Buffer
+	if scheme != "" {
+		buf.WriteString(scheme)
+		buf.WriteByte(':')
+	}
+	if u.Host != "" || u.User != nil {
+		buf.WriteString("//")
+		if u.User != nil {
+			buf.WriteString(u.User.String())
+			buf.WriteByte('@')
+		}
+		host, err := normalizeHost(u.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(host)
+		if port := u.Port(); port != "" && port != defaultPorts[scheme] {
+			buf.WriteByte(':')
+			buf.WriteString(port)
+		}
+	}
+
+	path := normalizePercentEncoding(u.EscapedPath())
+	if strings.HasPrefix(path, "/") {
+		path = removeDotSegments(path)
+	}
+	buf.WriteString(path)
+	if u.RawQuery != "" || u.ForceQuery {
+		buf.WriteByte('?')
+		buf.WriteString(normalizePercentEncoding(u.RawQuery))
+	}
+	if fragment := u.EscapedFragment(); fragment != "" {
+		buf.WriteByte('#')
+		buf.WriteString(normalizePercentEncoding(fragment))
+	}
+	return buf.Bytes(), nil
+}
+
+// normalizeStoredUrl return normalized url of saved link. New links are saved normalized already, links saved
+// before normalization are normalized on use. Url is returned as is if it can't be normalized.
+func normalizeStoredUrl(urlBytes []byte) []byte {
+	normalized, err := normalizeUrl(urlBytes)
+	if err != nil {
+		return urlBytes
+	}
+	return normalized
+}
+
+// normalizeHost lower case host and convert IDN to punycode by lookup profile of IDNA (UTS #46). IPv6 address
+// is returned in brackets. Ascii hosts are lower cased only, so they aren't validated by IDNA rules.
+// Trailing dot of fully qualified name is removed: "example.com." is the same host as "example.com".
+func normalizeHost(host string) (string, error) {
+	host = strings.ToLower(host)
+	if strings.Contains(host, ":") {
+		return "[" + strings.Replace(host, "%", "%25", -1) + "]", nil
+	}
+	if hasNonAscii(host) {
+		var err error
+		if host, err = idna.Lookup.ToASCII(host); err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimRight(host, "."), nil
+}
+
+func hasNonAscii(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+const upperHex = "0123456789ABCDEF"
+
+// normalizePercentEncoding decode percent-encoded unreserved symbols and upper case hex digits of other
+// percent-encoded bytes. Bad percent-encoding is kept as is.
+func normalizePercentEncoding(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	res := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			res = append(res, s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			res = append(res, c)
+		} else {
+			res = append(res, '%', upperHex[c>>4], upperHex[c&0xf])
+		}
+		i += 2
+	}
+	return string(res)
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	default:
+		return c - '0'
+	}
+}
+
+// isUnreserved return true for symbols, which are same with and without percent-encoding (RFC 3986, section 2.3)
+func isUnreserved(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// removeDotSegments remove "." and ".." segments from absolute path (RFC 3986, section 5.2.4).
+func removeDotSegments(path string) string {
+	segments := strings.Split(path[1:], "/")
+	res := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				res = append(res, "")
+			}
+		case "..":
+			if len(res) > 0 {
+				res = res[:len(res)-1]
+			}
+			if last {
+				res = append(res, "")
+			}
+		default:
+			res = append(res, segment)
+		}
+	}
+	return "/" + strings.Join(res, "/")
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Modes of handling of links to short urls of this service, selected by -own-links flag
+const (
+	ownLinksReject  = "reject"
+	ownLinksResolve = "resolve"
+	ownLinksAllow   = "allow"
+)
+
+// maxOwnLinksChain limit count of links of this service, followed from destination of one link
+const maxOwnLinksChain = 16
+
+var (
+	errOwnLink              = errors.New("Url is short link of this service")
+	errOwnLinkNotFound      = errors.New("Short link of this service doesn't exist")
+	errOwnLinksChainTooLong = errors.New("Too long chain of short links of this service")
+	errLinkCycle            = errors.New("Link would redirect to itself through other short links")
+)
+
+// ownUrlPrefix is parsed normalized prefix of short urls of this service. Path ends by '/'.
+type ownUrlPrefix struct {
+	Scheme string
+	Host   string
+	Path   string
+}
+
+var (
+	// ownUrlPrefixes are prefixes of short urls of this service
+	ownUrlPrefixes []ownUrlPrefix
+
+	// ownLinksMode is one of ownLinksReject, ownLinksResolve and ownLinksAllow
+	ownLinksMode = ownLinksReject
+
+	// shortenerDomains are normalized domains of other url shorteners
+	shortenerDomains []string
+)
+
+// setupOwnLinks set prefixes of short urls of this service (comma separated extraPrefixes are added to urlPrefix),
+// mode of links to them and comma separated domains of other shorteners.
+func setupOwnLinks(urlPrefix, extraPrefixes, mode, shortenerDomainsList string) error {
+	switch mode {
+	case ownLinksReject, ownLinksResolve, ownLinksAllow:
+	default:
+		return fmt.Errorf("Unknown mode of own links: '%v'", mode)
+	}
+
+	var prefixes []ownUrlPrefix
+	for _, prefix := range append([]string{urlPrefix}, splitList(extraPrefixes)...) {
+		normalized, err := normalizeUrl([]byte(prefix))
+		if err != nil {
+			return fmt.Errorf("Bad url prefix '%v': %v", prefix, err)
+		}
+		u, err := url.Parse(string(normalized))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("Bad url prefix '%v': it must have scheme and host", prefix)
+		}
+		path := u.EscapedPath()
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+		prefixes = append(prefixes, ownUrlPrefix{Scheme: u.Scheme, Host: u.Host, Path: path})
+	}
+
+	var domains []string
+	for _, domain := range splitList(shortenerDomainsList) {
+		normalized, err := normalizeHost(domain)
+		if err != nil {
+			return fmt.Errorf("Bad shortener domain '%v': %v", domain, err)
+		}
+		domains = append(domains, normalized)
+	}
+
+	ownUrlPrefixes = prefixes
+	ownLinksMode = mode
+	shortenerDomains = domains
+	return nil
+}
+
+// splitList split comma separated list and remove empty items
+func splitList(list string) []string {
+	var res []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// ownLinkId return encoded id (or alias) from normalized url if it is short url of this service: scheme and host
+// (with port) of url are same as of the prefix and path of url starts with path of the prefix. Http and https
+// are same scheme here: short link is opened by both of them.
+func ownLinkId(urlBytes []byte) (encodedId []byte, ok bool) {
+	u, err := url.Parse(string(urlBytes))
+	if err != nil || u.Opaque != "" {
+		return nil, false
+	}
+	scheme := ownLinkScheme(u.Scheme)
+	path := u.EscapedPath()
+	for _, prefix := range ownUrlPrefixes {
+		if scheme != ownLinkScheme(prefix.Scheme) || u.Host != prefix.Host || !strings.HasPrefix(path, prefix.Path) {
+			continue
+		}
+		return []byte(path[len(prefix.Path):]), true
+	}
+	return nil, false
+}
+
+// ownLinkScheme return "http" for https, so links are compared without difference between them
+func ownLinkScheme(scheme string) string {
+	if scheme == "https" {
+		return "http"
+	}
+	return scheme
+}
+
+// checkOwnLink reject links to other shorteners and handle links to this service by ownLinksMode. Return url
+// to save: destination of the short link in resolve mode, urlBytes otherwise. linkId is id of changed link,
+// nil for new links.
+func checkOwnLink(urlBytes, linkId []byte) ([]byte, error) {
+	if len(shortenerDomains) > 0 {
+		u, err := url.Parse(string(urlBytes))
+		if err != nil {
+			return nil, httpErrBadUrl.withErr(err)
+		}
+		host := u.Hostname()
+		for _, domain := range shortenerDomains {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return nil, httpErrShortenerUrl.withErr(fmt.Errorf("Host '%v' is url shortener", host))
+			}
+		}
+	}
+
+	if _, ok := ownLinkId(urlBytes); !ok {
+		return urlBytes, nil
+	}
+	switch ownLinksMode {
+	case ownLinksResolve:
+		return followOwnLinks(urlBytes, linkId)
+	case ownLinksAllow:
+		// destination must exist: link to missed id can make cycle after the id is created
+		if _, err := followOwnLinks(urlBytes, linkId); err != nil {
+			return nil, err
+		}
+		return urlBytes, nil
+	default:
+		return nil, httpErrOwnUrl.withErr(errOwnLink)
+	}
+}
+
+// followOwnLinks follow chain of short links of this service and return first url, which isn't short url
+// of this service. Return error if chain contain linkId or missed link.
+func followOwnLinks(urlBytes, linkId []byte) ([]byte, error) {
+	for i := 0; i < maxOwnLinksChain; i++ {
+		encodedId, ok := ownLinkId(urlBytes)
+		if !ok {
+			return urlBytes, nil
+		}
+		id, record, err := findLink(encodedId)
+		if err != nil {
+			if toHttpError(err).Status >= http.StatusInternalServerError {
+				return nil, err
+			}
+			return nil, httpErrOwnUrl.withErr(errOwnLinkNotFound)
+		}
+		if linkId != nil && bytes.Equal(id, linkId) {
+			return nil, httpErrLinkCycle.withErr(errLinkCycle)
+		}
+		urlBytes = normalizeStoredUrl(record.Url)
+	}
+	return nil, httpErrOwnUrl.withErr(errOwnLinksChainTooLong)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+//nolint:deadcode,megacheck
+func TestCheckOwnLink_Reject(t *testing.T) {
+	handlerTestInit()
+	defer handlerTestInit()
+	if err := setupOwnLinks("http://sho.rt/", "https://sho.rt/, http://short.example/s/, http://host:8080/, http://app.example/go", ownLinksReject, "bit.ly"); err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		url  string
+		code string
+	}{
+		{"http://sho.rt/AAAAAAAA", "own_url"},
+		{"HTTP://SHO.RT:80/AAAAAAAA", "own_url"},
+		{"https://sho.rt/AAAAAAAA?x=1", "own_url"},
+		{"http://short.example/s/AAAAAAAA", "own_url"},
+		{"http://bit.ly/abc", "shortener_url"},
+		{"http://www.Bit.ly/abc", "shortener_url"},
+		{"http://notbit.ly/abc", ""},
+		{"http://short.example/other", ""},
+		{"http://sho.rt.example.com/AAAAAAAA", ""},
+		{"http://sho.rt:8080/AAAAAAAA", ""},
+		{"http://user@sho.rt/AAAAAAAA", "own_url"},
+		{"http://short.example/sAAAAAAAA", ""},
+		{"http://short.evil.com/s/AAAAAAAA", ""},
+		{"http://host:8080/AAAAAAAA", "own_url"},
+		{"http://host:80801/x", ""},
+		{"http://host/AAAAAAAA", ""},
+		{"http://app.example/go/AAAAAAAA", "own_url"},
+		{"http://app.example/gone", ""},
+		{"https://app.example/go/AAAAAAAA", "own_url"},
+		{"https://host:8080/AAAAAAAA", "own_url"},
+		{"ftp://sho.rt/AAAAAAAA", ""},
+	}
+	for _, test := range table {
+		_, _, err := createLink([]byte(test.url), linkOptions{})
+		if code := toHttpError(err).Code; err != nil && code != test.code || err == nil && test.code != "" {
+			t.Error(test.url, err)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestCheckOwnLink_Resolve(t *testing.T) {
+	handlerTestInit()
+	defer handlerTestInit()
+	ownLinksMode = ownLinksResolve
+
+	encodedId := handlerTestStore(t, "http://example.com/final")
+	_, record, err := createLink([]byte("http://sho.rt/"+encodedId), linkOptions{})
+	if err != nil || string(record.Url) != "http://example.com/final" {
+		t.Error(err, string(record.Url))
+	}
+
+	if _, _, err = createLink([]byte("http://sho.rt/AAAAAAAA"), linkOptions{}); toHttpError(err).Code != "own_url" {
+		t.Error(err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestCheckOwnLink_AllowCycle(t *testing.T) {
+	handlerTestInit()
+	defer handlerTestInit()
+	defer func() { *adminToken = "" }()
+	*adminToken = testAdminToken
+	ownLinksMode = ownLinksAllow
+
+	first := handlerTestStore(t, "http://example.com/")
+	second := handlerTestStore(t, "http://sho.rt/"+first)
+	third := handlerTestStore(t, "http://sho.rt/"+second)
+
+	// link to missed link can make cycle later
+	if _, _, err := createLink([]byte("http://sho.rt/AAAAAAAA"), linkOptions{}); toHttpError(err).Code != "own_url" {
+		t.Error(err)
+	}
+
+	for _, target := range []string{"http://sho.rt/" + first, "http://sho.rt/" + third, "https://sho.rt/" + third} {
+		body := []byte(`{"url": "` + target + `"}`)
+		ctx := handlerTestAdminRequest("PUT", "/admin/links/"+first, testAdminToken, body)
+		if ctx.Response.StatusCode() != http.StatusConflict || string(ctx.Response.Header.Peek("X-Error-Code")) != "link_cycle" {
+			t.Error(target, ctx.Response.StatusCode(), string(ctx.Response.Body()))
+		}
+	}
+
+	body := []byte(`{"url": "http://sho.rt/` + first + `"}`)
+	ctx := handlerTestAdminRequest("PUT", "/admin/links/"+third, testAdminToken, body)
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Error(ctx.Response.StatusCode(), string(ctx.Response.Body()))
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestSetupOwnLinks_Errors(t *testing.T) {
+	defer handlerTestInit()
+	if err := setupOwnLinks("http://sho.rt/", "", "unknown", ""); err == nil {
+		t.Error(err)
+	}
+	if err := setupOwnLinks("http://sho.rt/", "http://[::1", ownLinksReject, ""); err == nil {
+		t.Error(err)
+	}
+	if err := setupOwnLinks("sho.rt/", "", ownLinksReject, ""); err == nil {
+		t.Error(err)
+	}
+}
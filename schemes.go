@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+var (
+	errEmptyUrl          = errors.New("Url is empty")
+	errNoScheme          = errors.New("Url has no scheme")
+	errNoHost            = errors.New("Url has no host")
+	errUnexpectedUrlHost = errors.New("Url of the scheme can't have host")
+	errEmptySchemeUrl    = errors.New("Url has nothing after scheme")
+	errBadTelNumber      = errors.New("Bad phone number")
+)
+
+// urlSchemeRule check url with allowed scheme
+type urlSchemeRule func(u *url.URL) error
+
+// urlSchemeRules is registry of rules, selectable for scheme in -url-schemes flag
+var urlSchemeRules = map[string]urlSchemeRule{
+	"host":   checkSchemeHost,
+	"mailto": checkSchemeMailto,
+	"tel":    checkSchemeTel,
+	"any":    checkSchemeAny,
+}
+
+// defaultSchemeRules are rules of schemes, listed without rule. Rule of other schemes is "any".
+var defaultSchemeRules = map[string]string{
+	"http":   "host",
+	"https":  "host",
+	"ftp":    "host",
+	"mailto": "mailto",
+	"tel":    "tel",
+}
+
+// forbiddenSchemes execute code or read local data in browser, they can't be allowed
+var forbiddenSchemes = map[string]bool{
+	"javascript": true,
+	"vbscript":   true,
+	"data":       true,
+	"file":       true,
+	"blob":       true,
+}
+
+type urlScheme struct {
+	RuleName string
+	Rule     urlSchemeRule
+}
+
+var (
+	allowedUrlSchemes = map[string]urlScheme{
+		"http":  {RuleName: "host", Rule: checkSchemeHost},
+		"https": {RuleName: "host", Rule: checkSchemeHost},
+		"ftp":   {RuleName: "host", Rule: checkSchemeHost},
+	}
+
+	// maxUrlLength is max length of url in bytes, after normalization
+	maxUrlLength = 3000
+)
+
+// setupUrlSchemes set allowed schemes from comma separated list "scheme[:rule]" and max length of urls.
+func setupUrlSchemes(list string, maxLength int) error {
+	if maxLength < 1 {
+		return fmt.Errorf("Max url length must be positive, got: %v", maxLength)
+	}
+
+	schemes := make(map[string]urlScheme)
+	for _, item := range splitList(list) {
+		name, ruleName := item, ""
+		if index := strings.IndexByte(item, ':'); index >= 0 {
+			name, ruleName = item[:index], item[index+1:]
+		}
+		name = strings.ToLower(name)
+		if name == "" || strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789+-.") != "" || name[0] < 'a' {
+			return fmt.Errorf("Bad url scheme: '%v'", name)
+		}
+		if forbiddenSchemes[name] {
+			return fmt.Errorf("Url scheme '%v' can't be allowed", name)
+		}
+
+		if ruleName == "" {
+			ruleName = defaultSchemeRules[name]
+		}
+		if ruleName == "" {
+			ruleName = "any"
+		}
+		rule, ok := urlSchemeRules[ruleName]
+		if !ok {
+			return fmt.Errorf("Unknown rule of url scheme '%v': '%v'", name, ruleName)
+		}
+		schemes[name] = urlScheme{RuleName: ruleName, Rule: rule}
+	}
+	if len(schemes) == 0 {
+		return errors.New("No allowed url schemes")
+	}
+
+	allowedUrlSchemes = schemes
+	maxUrlLength = maxLength
+	return nil
+}
+
+// checkUrl check length of url, its scheme and rule of the scheme. Error describe failed check.
+func checkUrl(urlBytes []byte) error {
+	if len(urlBytes) == 0 {
+		return errEmptyUrl
+	}
+	if len(urlBytes) > maxUrlLength {
+		return fmt.Errorf("Url is longer than %v bytes", maxUrlLength)
+	}
+
+	u, err := url.Parse(string(urlBytes))
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" {
+		return errNoScheme
+	}
+	scheme, ok := allowedUrlSchemes[strings.ToLower(u.Scheme)]
+	if !ok {
+		return fmt.Errorf("Url scheme '%v' isn't allowed", u.Scheme)
+	}
+	if err = scheme.Rule(u); err != nil {
+		return fmt.Errorf("Rule '%v' of url scheme '%v' failed: %v", scheme.RuleName, u.Scheme, err)
+	}
+	return nil
+}
+
+// hasNetworkHost return true if url has authority: host of such url is checked by host and destination rules
+// whatever rule of its scheme, so custom app schemes (myapp://host/) can't bypass them. Urls without authority
+// (mailto, tel, myapp:item) aren't checked.
+func hasNetworkHost(u *url.URL) bool {
+	return u.Host != ""
+}
+
+// checkSchemeHost require host: http://example.com/
+func checkSchemeHost(u *url.URL) error {
+	if u.Opaque != "" || u.Hostname() == "" {
+		return errNoHost
+	}
+	return nil
+}
+
+// checkSchemeMailto require list of email addresses without host: mailto:user@example.com?subject=hello
+func checkSchemeMailto(u *url.URL) error {
+	if u.Host != "" {
+		return errUnexpectedUrlHost
+	}
+	addresses, err := url.PathUnescape(u.Opaque)
+	if err != nil {
+		return err
+	}
+	if addresses == "" {
+		return errEmptySchemeUrl
+	}
+	for _, address := range strings.Split(addresses, ",") {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil {
+			return err
+		}
+		if parsed.Name != "" {
+			return fmt.Errorf("Address '%v' must be without name", address)
+		}
+	}
+	return nil
+}
+
+// checkSchemeTel require phone number (RFC 3966) without host: tel:+1-201-555-0123 or tel:7042;phone-context=example.com
+func checkSchemeTel(u *url.URL) error {
+	if u.Host != "" {
+		return errUnexpectedUrlHost
+	}
+	number := u.Opaque
+	if index := strings.IndexByte(number, ';'); index >= 0 {
+		number = number[:index]
+	}
+	number = strings.TrimPrefix(number, "+")
+	if strings.Trim(number, "0123456789-.()") != "" || strings.Trim(number, "-.()") == "" {
+		return errBadTelNumber
+	}
+	return nil
+}
+
+// checkSchemeAny require anything after scheme: myapp://open/item or myapp:item
+func checkSchemeAny(u *url.URL) error {
+	if u.Opaque == "" && u.Host == "" && u.Path == "" && u.RawQuery == "" {
+		return errEmptySchemeUrl
+	}
+	return nil
+}
+
+// requestLimits return max size of request body and size of read buffer (max size of request line and headers)
+// for urls up to maxUrlLength: batch of maxBatchSize urls in body or one percent-encoded url in query string.
+func requestLimits(maxUrlLength, maxBatchSize int) (maxBodySize, readBufferSize int) {
+	const (
+		minBodySize       = 64 * 1024
+		minReadBufferSize = 4096
+		// json escaping, quotes and separators; fields of create request
+		urlOverhead = 1024
+	)
+
+	maxBodySize = (2*maxUrlLength + urlOverhead) * maxBatchSize
+	if maxBodySize < minBodySize {
+		maxBodySize = minBodySize
+	}
+	readBufferSize = 3*maxUrlLength + minReadBufferSize
+	return maxBodySize, readBufferSize
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+//nolint:deadcode,megacheck
+func TestSetupUrlSchemes(t *testing.T) {
+	defer setupUrlSchemes("http,https,ftp", 3000) //nolint:errcheck
+
+	table := []struct {
+		list  string
+		rules map[string]string
+		ok    bool
+	}{
+		{"http,https,ftp", map[string]string{"http": "host", "https": "host", "ftp": "host"}, true},
+		{" HTTPS , mailto,tel", map[string]string{"https": "host", "mailto": "mailto", "tel": "tel"}, true},
+		{"myapp,my-app2:host,mailto:any", map[string]string{"myapp": "any", "my-app2": "host", "mailto": "any"}, true},
+		{"", nil, false},
+		{",", nil, false},
+		{"http,javascript", nil, false},
+		{"DATA", nil, false},
+		{"file", nil, false},
+		{"myapp:unknown", nil, false},
+		{"1app", nil, false},
+		{"my_app", nil, false},
+		{":host", nil, false},
+	}
+	for _, test := range table {
+		err := setupUrlSchemes(test.list, 100)
+		if (err == nil) != test.ok {
+			t.Error(test.list, err)
+			continue
+		}
+		if !test.ok {
+			continue
+		}
+		if len(allowedUrlSchemes) != len(test.rules) {
+			t.Error(test.list, allowedUrlSchemes)
+		}
+		for scheme, rule := range test.rules {
+			if allowedUrlSchemes[scheme].RuleName != rule {
+				t.Error(test.list, scheme, allowedUrlSchemes[scheme].RuleName)
+			}
+		}
+	}
+
+	if setupUrlSchemes("http", 0) == nil {
+		t.Error("zero length")
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestCheckUrl(t *testing.T) {
+	defer setupUrlSchemes("http,https,ftp", 3000) //nolint:errcheck
+
+	if err := setupUrlSchemes("http,https,mailto,tel,myapp", 50); err != nil {
+		t.Fatal(err)
+	}
+	table := []struct {
+		url string
+		err string
+	}{
+		{"http://example.com/", ""},
+		{"https://example.com/?q=1", ""},
+		{"mailto:user@example.com", ""},
+		{"mailto:a@example.com,b@example.org?subject=hi", ""},
+		{"mailto:user%40example.com", ""},
+		{"tel:+1-201-555-0123", ""},
+		{"tel:7042;phone-context=example.com", ""},
+		{"myapp://open/item", ""},
+		{"myapp:item", ""},
+
+		{"", "empty"},
+		{"http://example.com/" + strings.Repeat("a", 32), "longer than 50"},
+		{"example.com", "no scheme"},
+		{"ftp://example.com/", "'ftp' isn't allowed"},
+		{"javascript:alert(1)", "'javascript' isn't allowed"},
+		{"http:example.com", "Rule 'host' of url scheme 'http' failed"},
+		{"http:///path", "Rule 'host' of url scheme 'http' failed"},
+		{"mailto:", "Rule 'mailto' of url scheme 'mailto' failed"},
+		{"mailto:not-an-address", "Rule 'mailto' of url scheme 'mailto' failed"},
+		{"mailto:Name <user@example.com>", "Rule 'mailto' of url scheme 'mailto' failed"},
+		{"mailto://example.com/", "Rule 'mailto' of url scheme 'mailto' failed"},
+		{"tel:", "Rule 'tel' of url scheme 'tel' failed"},
+		{"tel:+", "Rule 'tel' of url scheme 'tel' failed"},
+		{"tel:call-me", "Rule 'tel' of url scheme 'tel' failed"},
+		{"myapp:", "Rule 'any' of url scheme 'myapp' failed"},
+	}
+	for _, test := range table {
+		err := checkUrl([]byte(test.url))
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Error(test.url, err)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestRequestLimits(t *testing.T) {
+	body, buffer := requestLimits(3000, 1000)
+	if body < 3000*1000 || buffer < 3*3000 {
+		t.Error(body, buffer)
+	}
+	body, buffer = requestLimits(10, 1)
+	if body < 64*1024 || buffer < 4096 {
+		t.Error(body, buffer)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStoreUrlSchemes(t *testing.T) {
+	handlerTestInit()
+	defer handlerTestInit()
+
+	if err := setupUrlSchemes("http,mailto,tel,myapp", 3000); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := parseHostRules("block *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostRulesList = &hostRulesFile{rules: rules}
+	if err = setupDestinationPolicy(destinationPublic, 0); err != nil {
+		t.Fatal(err)
+	}
+	destinationResolver = testResolver{}
+
+	// host and destination rules are for urls with host only
+	for _, u := range []string{"mailto:user@example.com", "tel:+12015550123", "myapp:item"} {
+		id, _, err := createLink([]byte(u), linkOptions{})
+		if err != nil {
+			t.Error(u, err)
+			continue
+		}
+		_, record, err := findLink(makeLinkUrl(nil, id))
+		if err != nil || string(record.Url) != u {
+			t.Error(u, string(record.Url), err)
+		}
+	}
+
+	// rule of scheme doesn't disable checks of host
+	for _, u := range []string{"http://example.com/", "myapp://open/item"} {
+		_, _, err = createLink([]byte(u), linkOptions{})
+		if httpErr := toHttpError(err); httpErr.Status != http.StatusForbidden {
+			t.Error(u, err)
+		}
+	}
+	hostRulesList = nil
+	_, _, err = createLink([]byte("myapp://127.0.0.1/item"), linkOptions{})
+	if httpErr := toHttpError(err); httpErr.Status != http.StatusBadRequest || httpErr.Code != "private_destination" {
+		t.Error(err)
+	}
+	_, _, err = createLink([]byte("https://example.com/"), linkOptions{})
+	if httpErr := toHttpError(err); httpErr.Status != http.StatusBadRequest || httpErr.Code != "bad_url" ||
+		!strings.Contains(err.Error(), "'https' isn't allowed") {
+		t.Error(err)
+	}
+}
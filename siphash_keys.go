@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	dchest "github.com/dchest/siphash"
+)
+
+// sipHashKeySize is size of siphash key in bytes, key is written as 2*sipHashKeySize hex digits
+const sipHashKeySize = 16
+
+// sipHashKeysEnv is name of environment variable with keys in same format as keys file, keys may be separated by ';'
+const sipHashKeysEnv = "URL_SHORT_SIPHASH_KEYS"
+
+// sipHashKeyring is set of keys for siphash generator. New ids are generated with active key only, other keys
+// are kept for rotation: ids, generated by them, are saved in storage and resolve without the keys.
+// Id of key is added before hashed value, so different keys never give same hash sequence for same url.
+type sipHashKeyring struct {
+	Keys     map[byte][]byte
+	ActiveId byte
+}
+
+// sipHashKeys is used by siphash generator. Default keyring has public key from sources only.
+var sipHashKeys = sipHashKeyring{Keys: map[byte][]byte{0: sipHashKey}}
+
+var (
+	errSipHashNoActiveKey    = errors.New("No active siphash key")
+	errSipHashManyActive     = errors.New("Only one siphash key may be active")
+	errSipHashKeysFileAndEnv = errors.New("Siphash keys may be set by file or by environment variable, not both")
+)
+
+// parseSipHashKeys parse keys: one key per line (or separated by ';') in format "[*]<id>=<32 hex digits>",
+// id is number from 0 to 255, active key is marked by '*'. Empty lines and lines started with '#' are skipped.
+func parseSipHashKeys(text string) (sipHashKeyring, error) {
+	res := sipHashKeyring{Keys: make(map[byte][]byte)}
+	activeFound := false
+	for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ';' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		active := strings.HasPrefix(line, "*")
+		line = strings.TrimPrefix(line, "*")
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return sipHashKeyring{}, fmt.Errorf("Bad siphash key line, expected [*]<id>=<hex key>: '%v'", line)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 8)
+		if err != nil {
+			return sipHashKeyring{}, fmt.Errorf("Bad siphash key id '%v': %v", parts[0], err)
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil || len(key) != sipHashKeySize {
+			return sipHashKeyring{}, fmt.Errorf("Siphash key %v must be %v hex digits", id, sipHashKeySize*2)
+		}
+		if _, exist := res.Keys[byte(id)]; exist {
+			return sipHashKeyring{}, fmt.Errorf("Duplicated siphash key id: %v", id)
+		}
+		res.Keys[byte(id)] = key
+
+		if active {
+			if activeFound {
+				return sipHashKeyring{}, errSipHashManyActive
+			}
+			activeFound = true
+			res.ActiveId = byte(id)
+		}
+	}
+	if !activeFound {
+		return sipHashKeyring{}, errSipHashNoActiveKey
+	}
+	return res, nil
+}
+
+// loadSipHashKeys load keys from file or from value of environment variable. Return default keyring if both are empty.
+func loadSipHashKeys(fileName, envValue string) (sipHashKeyring, error) {
+	switch {
+	case fileName != "" && envValue != "":
+		return sipHashKeyring{}, errSipHashKeysFileAndEnv
+	case fileName != "":
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return sipHashKeyring{}, err
+		}
+		return parseSipHashKeys(string(content))
+	case envValue != "":
+		return parseSipHashKeys(envValue)
+	default:
+		return sipHashKeyring{Keys: map[byte][]byte{0: sipHashKey}}, nil
+	}
+}
+
+// IsDefault return true if active key is the public key from sources
+func (k sipHashKeyring) IsDefault() bool {
+	return bytes.Equal(k.Keys[k.ActiveId], sipHashKey)
+}
+
+// checkSipHashKeys refuse siphash generator with default key: its ids are predictable.
+func checkSipHashKeys(generatorName string, keys sipHashKeyring, allowDefault bool) error {
+	if generatorName == "siphash" && keys.IsDefault() && !allowDefault {
+		return fmt.Errorf("Siphash generator is used with default public key. Set keys by -siphash-keys-file or %v "+
+			"environment variable, or allow default key by -siphash-allow-default-key (insecure)", sipHashKeysEnv)
+	}
+	return nil
+}
+
+// newSipHashFunc make generator with active key of sipHashKeys
+func newSipHashFunc(length int) HashFunc {
+	keyId := sipHashKeys.ActiveId
+	key := sipHashKeys.Keys[keyId]
+	k0, k1 := binary.LittleEndian.Uint64(key), binary.LittleEndian.Uint64(key[8:])
+	return func(value []byte) []byte {
+		input := make([]byte, 1+len(value))
+		input[0] = keyId
+		copy(input[1:], value)
+
+		res := make([]byte, 8)
+		binary.LittleEndian.PutUint64(res, dchest.Hash(k0, k1, input))
+		return res[:length]
+	}
+}
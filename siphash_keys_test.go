@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testSipHashKey1 = "000102030405060708090a0b0c0d0e0f"
+	testSipHashKey2 = "f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff"
+)
+
+//nolint:deadcode,megacheck
+func TestParseSipHashKeys(t *testing.T) {
+	keys, err := parseSipHashKeys("# old key\n1=" + testSipHashKey1 + "\n\n*2 = " + testSipHashKey2 + "\n")
+	if err != nil || len(keys.Keys) != 2 || keys.ActiveId != 2 || keys.IsDefault() {
+		t.Fatal(err, keys)
+	}
+	if keys.Keys[2][0] != 0xf0 {
+		t.Error(keys.Keys[2])
+	}
+
+	if keys, err = parseSipHashKeys("*1=" + testSipHashKey1 + ";2=" + testSipHashKey2); err != nil || keys.ActiveId != 1 {
+		t.Error(err, keys)
+	}
+
+	for _, text := range []string{
+		"",
+		"1=" + testSipHashKey1,
+		"*1=" + testSipHashKey1 + "\n*2=" + testSipHashKey2,
+		"*1=" + testSipHashKey1 + "\n1=" + testSipHashKey2,
+		"*1=0011",
+		"*1=" + testSipHashKey1 + "zz",
+		"*1=" + testSipHashKey1 + "00",
+		"*1=" + testSipHashKey1[:30],
+		"*256=" + testSipHashKey1,
+		"*" + testSipHashKey1,
+	} {
+		if _, err := parseSipHashKeys(text); err == nil {
+			t.Error(text)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestLoadSipHashKeys(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	fileName := filepath.Join(tmpDir, "keys")
+	ioutil.WriteFile(fileName, []byte("*5="+testSipHashKey1), DEFAULT_FILE_MODE)
+
+	if keys, err := loadSipHashKeys(fileName, ""); err != nil || keys.ActiveId != 5 {
+		t.Error(err, keys)
+	}
+	if keys, err := loadSipHashKeys("", "*6="+testSipHashKey2); err != nil || keys.ActiveId != 6 {
+		t.Error(err, keys)
+	}
+	if _, err := loadSipHashKeys(fileName, "*6="+testSipHashKey2); err != errSipHashKeysFileAndEnv {
+		t.Error(err)
+	}
+	if keys, err := loadSipHashKeys("", ""); err != nil || !keys.IsDefault() {
+		t.Error(err, keys)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestCheckSipHashKeys(t *testing.T) {
+	defaultKeys, _ := loadSipHashKeys("", "")
+	if err := checkSipHashKeys("siphash", defaultKeys, false); err == nil {
+		t.Error(err)
+	}
+	if err := checkSipHashKeys("siphash", defaultKeys, true); err != nil {
+		t.Error(err)
+	}
+	if err := checkSipHashKeys("random", defaultKeys, false); err != nil {
+		t.Error(err)
+	}
+	keys, _ := parseSipHashKeys("*1=" + testSipHashKey1)
+	if err := checkSipHashKeys("siphash", keys, false); err != nil {
+		t.Error(err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestNewSipHashFunc_Rotation(t *testing.T) {
+	oldKeys := sipHashKeys
+	defer func() { sipHashKeys = oldKeys }()
+
+	hashes := make(map[string]bool)
+	for _, text := range []string{
+		"*1=" + testSipHashKey1,
+		"*2=" + testSipHashKey1,
+		"1=" + testSipHashKey1 + "\n*3=" + testSipHashKey2,
+	} {
+		keys, err := parseSipHashKeys(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sipHashKeys = keys
+		id := newSipHashFunc(8)([]byte("http://example.com"))
+		if hashes[string(id)] {
+			t.Error(text, id)
+		}
+		hashes[string(id)] = true
+
+		if other := newSipHashFunc(6)([]byte("http://example.com")); !bytes.Equal(other, id[:6]) {
+			t.Error(other, id)
+		}
+	}
+}
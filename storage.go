@@ -1,13 +1,143 @@
 package main
 
-import "errors"
+import (
+	"errors"
+	"log"
+	"time"
+)
 
 var (
-	errNoKey = errors.New("Key doesn't exist")
-	errDuplicate = errors.New("Key duplication")
+	errNoKey         = errors.New("Key doesn't exist")
+	errDuplicate     = errors.New("Key duplication")
+	errValueMismatch = errors.New("Value doesn't match expected")
+	errNotSupported  = errors.New("Operation isn't supported by storage")
 )
 
+// Storage implementations have to return errNoKey from Get for missing keys and errDuplicate from Store
+// for existed keys. Any other error means the backend failure.
 type Storage interface {
-	Store (key, value []byte)error
-	Get(key []byte)(value []byte, err error)
-}
\ No newline at end of file
+	Store(key, value []byte) error
+	Get(key []byte) (value []byte, err error)
+}
+
+// MutableStorage is optional interface for backends, which can change saved items.
+// Delete and Update return errNoKey for missing keys. Update replace value only if current value is equal
+// to oldValue and return errValueMismatch otherwise.
+type MutableStorage interface {
+	Storage
+	Delete(key []byte) error
+	Exists(key []byte) (bool, error)
+	Update(key, oldValue, newValue []byte) error
+}
+
+// BatchStorage is optional interface for backends, which can store many items faster than one by one.
+// StoreBatch return error for every item with same meaning as Store.
+type BatchStorage interface {
+	StoreBatch(keys, values [][]byte) []error
+}
+
+// storeBatch store items by one call if storage support it and one by one otherwise.
+func storeBatch(s Storage, keys, values [][]byte) []error {
+	if batchStorage, ok := s.(BatchStorage); ok {
+		return batchStorage.StoreBatch(keys, values)
+	}
+
+	errs := make([]error, len(keys))
+	for i := range keys {
+		errs[i] = s.Store(keys[i], values[i])
+	}
+	return errs
+}
+
+// DedupStorage is optional interface for backends, which can save item together with reverse index item atomically.
+// StoreDedup save key → value and dedupKey → key if dedupKey doesn't exist. If dedupKey exists - nothing is saved
+// and key from reverse index is returned as existingKey. Return errDuplicate if key exists.
+type DedupStorage interface {
+	StoreDedup(dedupKey, key, value []byte) (existingKey []byte, err error)
+}
+
+// storeDedup save item with reverse index item by one call if storage support it. Otherwise it save item first and
+// reverse index item after that, so from concurrent calls only one can save reverse index item. Items of other calls
+// are deleted if storage support it.
+func storeDedup(s Storage, dedupKey, key, value []byte) (existingKey []byte, err error) {
+	if dedupStorage, ok := s.(DedupStorage); ok {
+		return dedupStorage.StoreDedup(dedupKey, key, value)
+	}
+
+	existingKey, err = s.Get(dedupKey)
+	if err != errNoKey {
+		return existingKey, err
+	}
+	if err = s.Store(key, value); err != nil {
+		return nil, err
+	}
+	err = s.Store(dedupKey, key)
+	if err != errDuplicate {
+		return nil, err
+	}
+
+	if mutableStorage, ok := s.(MutableStorage); ok {
+		if err = mutableStorage.Delete(key); err != nil {
+			log.Printf("Can't delete duplicated item: %v", err)
+		}
+	}
+	return s.Get(dedupKey)
+}
+
+// ExpiringStorage is optional interface for backends, which can remove items after expiration time.
+// StoreExpiring save item same way as Store does. The item is removed from storage some time after expireAt:
+// by backend itself or by RemoveExpired.
+type ExpiringStorage interface {
+	StoreExpiring(key, value []byte, expireAt time.Time) error
+
+	// RemoveExpired delete items with expireAt before now. Return count of deleted items.
+	RemoveExpired(now time.Time) (int, error)
+}
+
+// storeExpiring store item with expiration if storage support it. Storages without expiration keep item forever.
+func storeExpiring(s Storage, key, value []byte, expireAt time.Time) error {
+	if expiringStorage, ok := s.(ExpiringStorage); ok && !expireAt.IsZero() {
+		return expiringStorage.StoreExpiring(key, value, expireAt)
+	}
+	return s.Store(key, value)
+}
+
+// runExpiredSweeper call RemoveExpired every interval. It never returns.
+func runExpiredSweeper(s ExpiringStorage, interval time.Duration) {
+	for range time.Tick(interval) {
+		count, err := s.RemoveExpired(time.Now())
+		if err != nil {
+			log.Printf("Can't remove expired items from storage: %v", err)
+		}
+		if count > 0 {
+			log.Printf("Removed expired items: %v", count)
+		}
+	}
+}
+
+// ClickStats is statistic of link usage. Times are zero for links without clicks.
+type ClickStats struct {
+	Count       int64
+	FirstAccess time.Time
+	LastAccess  time.Time
+}
+
+// Add merge other stats into s
+func (s *ClickStats) Add(other ClickStats) {
+	s.Count += other.Count
+	if s.FirstAccess.IsZero() || !other.FirstAccess.IsZero() && other.FirstAccess.Before(s.FirstAccess) {
+		s.FirstAccess = other.FirstAccess
+	}
+	if other.LastAccess.After(s.LastAccess) {
+		s.LastAccess = other.LastAccess
+	}
+}
+
+// ClickStorage is optional interface for backends, which can count clicks of links.
+// AddClicks merge stats to saved stats of key: add count, keep earliest first access and latest last access.
+// AddClicks drop stats of keys, which don't exist (deleted or removed as expired), without error.
+// GetClicks return zero stats for keys without clicks. Stats are removed with the key by Delete and RemoveExpired.
+type ClickStorage interface {
+	AddClicks(key []byte, stats ClickStats) error
+	GetClicks(key []byte) (ClickStats, error)
+}
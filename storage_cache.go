@@ -0,0 +1,281 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StorageCache keep recent results of Get from inner storage in memory. Size of cache is limited by count of items
+// and by sum of keys and values lengths, least recently used items are removed first.
+// Concurrent Get of same missed key call inner storage once. Missed keys are cached for negativeTTL if it isn't 0.
+//
+// Changes through StorageCache invalidate cached items. Changes of inner storage by other ways (other processes,
+// expiration inside backend) are visible after item is evicted from cache.
+// Methods of optional interfaces (except StoreBatch, StoreExpiring and StoreDedup, which have fallbacks) return errNotSupported
+// if inner storage doesn't implement them.
+type StorageCache struct {
+	inner       Storage
+	maxEntries  int
+	maxBytes    int
+	negativeTTL time.Duration
+
+	mutex sync.Mutex
+	lru   *list.List // front is most recently used
+	items map[string]*list.Element
+	bytes int
+	calls map[string]*storageCacheCall
+
+	hits   int64
+	misses int64
+}
+
+type storageCacheEntry struct {
+	key   string
+	value []byte
+
+	// negativeUntil isn't zero for cached errNoKey result
+	negativeUntil time.Time
+}
+
+// storageCacheCall is Get of inner storage in progress
+type storageCacheCall struct {
+	done  chan struct{}
+	value []byte
+	err   error
+
+	// invalidated is true if key was changed while call, result must not be cached
+	invalidated bool
+}
+
+// StorageCacheStats is counters of cache usage
+type StorageCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+	Bytes   int   `json:"bytes"`
+}
+
+// checkStorageCacheLimits check values of -cache-entries and -cache-bytes flags: count of entries can't be negative
+// (0 disable cache), size must be positive if cache is enabled and can't be negative anyway.
+func checkStorageCacheLimits(maxEntries, maxBytes int) error {
+	if maxEntries < 0 {
+		return fmt.Errorf("Max count of cache entries can't be negative, got: %v", maxEntries)
+	}
+	if maxBytes < 0 || maxEntries > 0 && maxBytes == 0 {
+		return fmt.Errorf("Max size of cache must be positive, got: %v", maxBytes)
+	}
+	return nil
+}
+
+// NewStorageCache wrap storage by cache. maxEntries and maxBytes must be positive, negativeTTL 0 disable
+// caching of missed keys.
+func NewStorageCache(inner Storage, maxEntries, maxBytes int, negativeTTL time.Duration) *StorageCache {
+	return &StorageCache{
+		inner:       inner,
+		maxEntries:  maxEntries,
+		maxBytes:    maxBytes,
+		negativeTTL: negativeTTL,
+		lru:         list.New(),
+		items:       make(map[string]*list.Element),
+		calls:       make(map[string]*storageCacheCall),
+	}
+}
+
+func (s *StorageCache) Get(key []byte) ([]byte, error) {
+	keyString := string(key)
+
+	s.mutex.Lock()
+	if elem, exist := s.items[keyString]; exist {
+		entry := elem.Value.(*storageCacheEntry)
+		if entry.negativeUntil.IsZero() || time.Now().Before(entry.negativeUntil) {
+			s.lru.MoveToFront(elem)
+			s.mutex.Unlock()
+			atomic.AddInt64(&s.hits, 1)
+			if !entry.negativeUntil.IsZero() {
+				return nil, errNoKey
+			}
+			return entry.value, nil
+		}
+		s.removeLocked(elem)
+	}
+	atomic.AddInt64(&s.misses, 1)
+
+	if call, exist := s.calls[keyString]; exist {
+		s.mutex.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call := &storageCacheCall{done: make(chan struct{})}
+	s.calls[keyString] = call
+	s.mutex.Unlock()
+
+	call.value, call.err = s.inner.Get(key)
+
+	s.mutex.Lock()
+	delete(s.calls, keyString)
+	if !call.invalidated {
+		switch {
+		case call.err == nil:
+			s.addLocked(&storageCacheEntry{key: keyString, value: call.value})
+		case call.err == errNoKey && s.negativeTTL > 0:
+			s.addLocked(&storageCacheEntry{key: keyString, negativeUntil: time.Now().Add(s.negativeTTL)})
+		}
+	}
+	s.mutex.Unlock()
+	close(call.done)
+
+	return call.value, call.err
+}
+
+func (s *StorageCache) addLocked(entry *storageCacheEntry) {
+	s.items[entry.key] = s.lru.PushFront(entry)
+	s.bytes += len(entry.key) + len(entry.value)
+	for s.lru.Len() > 0 && (s.lru.Len() > s.maxEntries || s.bytes > s.maxBytes) {
+		s.removeLocked(s.lru.Back())
+	}
+}
+
+func (s *StorageCache) removeLocked(elem *list.Element) {
+	entry := elem.Value.(*storageCacheEntry)
+	s.lru.Remove(elem)
+	delete(s.items, entry.key)
+	s.bytes -= len(entry.key) + len(entry.value)
+}
+
+// invalidate remove key from cache and prevent caching of result of Get in progress.
+func (s *StorageCache) invalidate(key []byte) {
+	keyString := string(key)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if elem, exist := s.items[keyString]; exist {
+		s.removeLocked(elem)
+	}
+	if call, exist := s.calls[keyString]; exist {
+		call.invalidated = true
+	}
+}
+
+// Purge remove all items from cache.
+func (s *StorageCache) Purge() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lru.Init()
+	s.items = make(map[string]*list.Element)
+	s.bytes = 0
+	for _, call := range s.calls {
+		call.invalidated = true
+	}
+}
+
+func (s *StorageCache) Stats() StorageCacheStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return StorageCacheStats{
+		Hits:    atomic.LoadInt64(&s.hits),
+		Misses:  atomic.LoadInt64(&s.misses),
+		Entries: s.lru.Len(),
+		Bytes:   s.bytes,
+	}
+}
+
+// Store invalidate cached missed key.
+func (s *StorageCache) Store(key, value []byte) error {
+	err := s.inner.Store(key, value)
+	if err == nil {
+		s.invalidate(key)
+	}
+	return err
+}
+
+func (s *StorageCache) StoreBatch(keys, values [][]byte) []error {
+	errs := storeBatch(s.inner, keys, values)
+	for i, err := range errs {
+		if err == nil {
+			s.invalidate(keys[i])
+		}
+	}
+	return errs
+}
+
+func (s *StorageCache) StoreDedup(dedupKey, key, value []byte) ([]byte, error) {
+	existingKey, err := storeDedup(s.inner, dedupKey, key, value)
+	if err == nil && existingKey == nil {
+		s.invalidate(key)
+		s.invalidate(dedupKey)
+	}
+	return existingKey, err
+}
+
+func (s *StorageCache) Delete(key []byte) error {
+	mutableStorage, ok := s.inner.(MutableStorage)
+	if !ok {
+		return errNotSupported
+	}
+	// invalidate after change too: Get, started before the change, can't put old value to cache
+	s.invalidate(key)
+	defer s.invalidate(key)
+	return mutableStorage.Delete(key)
+}
+
+func (s *StorageCache) Exists(key []byte) (bool, error) {
+	mutableStorage, ok := s.inner.(MutableStorage)
+	if !ok {
+		return false, errNotSupported
+	}
+	return mutableStorage.Exists(key)
+}
+
+func (s *StorageCache) Update(key, oldValue, newValue []byte) error {
+	mutableStorage, ok := s.inner.(MutableStorage)
+	if !ok {
+		return errNotSupported
+	}
+	s.invalidate(key)
+	defer s.invalidate(key)
+	return mutableStorage.Update(key, oldValue, newValue)
+}
+
+// StoreExpiring keep item forever if inner storage doesn't support expiration, same as storeExpiring.
+func (s *StorageCache) StoreExpiring(key, value []byte, expireAt time.Time) error {
+	err := storeExpiring(s.inner, key, value, expireAt)
+	if err == nil {
+		s.invalidate(key)
+	}
+	return err
+}
+
+// RemoveExpired purge whole cache if any item was removed, because removed keys are unknown.
+func (s *StorageCache) RemoveExpired(now time.Time) (int, error) {
+	expiringStorage, ok := s.inner.(ExpiringStorage)
+	if !ok {
+		return 0, errNotSupported
+	}
+	count, err := expiringStorage.RemoveExpired(now)
+	if count > 0 {
+		s.Purge()
+	}
+	return count, err
+}
+
+func (s *StorageCache) AddClicks(key []byte, stats ClickStats) error {
+	clickStorage, ok := s.inner.(ClickStorage)
+	if !ok {
+		return errNotSupported
+	}
+	return clickStorage.AddClicks(key, stats)
+}
+
+func (s *StorageCache) GetClicks(key []byte) (ClickStats, error) {
+	clickStorage, ok := s.inner.(ClickStorage)
+	if !ok {
+		return ClickStats{}, errNotSupported
+	}
+	return clickStorage.GetClicks(key)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	_ MutableStorage  = &StorageCache{}
+	_ BatchStorage    = &StorageCache{}
+	_ ExpiringStorage = &StorageCache{}
+	_ ClickStorage    = &StorageCache{}
+	_ DedupStorage    = &StorageCache{}
+)
+
+// storageCounting count Get calls of inner storage and wait release before answer if it isn't nil
+type storageCounting struct {
+	Storage
+
+	mutex    sync.Mutex
+	getCount int
+	release  chan struct{}
+}
+
+func (s *storageCounting) Get(key []byte) ([]byte, error) {
+	s.mutex.Lock()
+	s.getCount++
+	s.mutex.Unlock()
+	if s.release != nil {
+		<-s.release
+	}
+	return s.Storage.Get(key)
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageCache_Get(t *testing.T) {
+	inner := &storageCounting{Storage: NewStorageMap()}
+	s := NewStorageCache(inner, 10, 1000, 0)
+	s.Store([]byte("1"), []byte("one"))
+
+	for i := 0; i < 3; i++ {
+		if val, err := s.Get([]byte("1")); err != nil || string(val) != "one" {
+			t.Error(err, string(val))
+		}
+		if _, err := s.Get([]byte("2")); err != errNoKey {
+			t.Error(err)
+		}
+	}
+	if inner.getCount != 4 {
+		t.Error(inner.getCount)
+	}
+	if stats := s.Stats(); stats.Hits != 2 || stats.Misses != 4 || stats.Entries != 1 || stats.Bytes != 4 {
+		t.Error(stats)
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageCache_Evict(t *testing.T) {
+	inner := &storageCounting{Storage: NewStorageMap()}
+	s := NewStorageCache(inner, 2, 12, 0)
+	for _, key := range []string{"1", "2", "3"} {
+		inner.Store([]byte(key), []byte("val"))
+	}
+	inner.Store([]byte("big"), []byte("big-value"))
+
+	s.Get([]byte("1"))
+	s.Get([]byte("2"))
+	s.Get([]byte("1"))
+	s.Get([]byte("3")) // evict 2 by count
+	if _, exist := s.items["2"]; exist || len(s.items) != 2 {
+		t.Error(s.items)
+	}
+	s.Get([]byte("big")) // evict all other by bytes
+	if _, exist := s.items["big"]; !exist || len(s.items) != 1 || s.bytes != 12 {
+		t.Error(s.items, s.bytes)
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageCache_BadLimits(t *testing.T) {
+	table := []struct {
+		maxEntries int
+		maxBytes   int
+		ok         bool
+	}{
+		{100, 1024, true},
+		{0, 1024, true},
+		{0, 0, true},
+		{-1, 1024, false},
+		{100, -1, false},
+		{0, -1, false},
+		{100, 0, false},
+	}
+	for _, test := range table {
+		if err := checkStorageCacheLimits(test.maxEntries, test.maxBytes); (err == nil) != test.ok {
+			t.Error(test.maxEntries, test.maxBytes, err)
+		}
+	}
+
+	// cache with bad limits keeps nothing instead of panic
+	inner := NewStorageMap()
+	inner.Store([]byte("1"), []byte("val"))
+	for _, s := range []*StorageCache{NewStorageCache(inner, -1, 1024, 0), NewStorageCache(inner, 100, -1, 0)} {
+		if val, err := s.Get([]byte("1")); err != nil || string(val) != "val" {
+			t.Error(err, string(val))
+		}
+		if len(s.items) != 0 || s.lru.Len() != 0 || s.bytes != 0 {
+			t.Error(s.items, s.bytes)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageCache_Negative(t *testing.T) {
+	inner := &storageCounting{Storage: NewStorageMap()}
+	s := NewStorageCache(inner, 10, 1000, 100*time.Millisecond)
+
+	s.Get([]byte("1"))
+	s.Get([]byte("1"))
+	if inner.getCount != 1 {
+		t.Error(inner.getCount)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	s.Get([]byte("1"))
+	if inner.getCount != 2 {
+		t.Error(inner.getCount)
+	}
+
+	// store through cache remove negative entry
+	s.Store([]byte("1"), []byte("one"))
+	if val, err := s.Get([]byte("1")); err != nil || string(val) != "one" {
+		t.Error(err, string(val))
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageCache_CollapseMisses(t *testing.T) {
+	inner := &storageCounting{Storage: NewStorageMap(), release: make(chan struct{})}
+	s := NewStorageCache(inner, 10, 1000, 0)
+
+	const count = 10
+	var wg sync.WaitGroup
+	wg.Add(count)
+	for i := 0; i < count; i++ {
+		go func() {
+			defer wg.Done()
+			if _, err := s.Get([]byte("1")); err != errNoKey {
+				t.Error(err)
+			}
+		}()
+	}
+	for {
+		s.mutex.Lock()
+		started := len(s.calls) == 1 && s.misses == count
+		s.mutex.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(inner.release)
+	wg.Wait()
+
+	if inner.getCount != 1 {
+		t.Error(inner.getCount)
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageCache_InvalidateInProgress(t *testing.T) {
+	inner := &storageCounting{Storage: NewStorageMap(), release: make(chan struct{})}
+	s := NewStorageCache(inner, 10, 1000, 0)
+	inner.Storage.Store([]byte("1"), []byte("old"))
+
+	done := make(chan struct{})
+	go func() {
+		s.Get([]byte("1"))
+		close(done)
+	}()
+	for {
+		s.mutex.Lock()
+		started := len(s.calls) == 1
+		s.mutex.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.invalidate([]byte("1"))
+	close(inner.release)
+	<-done
+
+	if len(s.items) != 0 {
+		t.Error(s.items)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageCache_NotSupported(t *testing.T) {
+	s := NewStorageCache(storageFailing{}, 10, 1000, 0)
+	if err := s.Delete([]byte("1")); err != errNotSupported {
+		t.Error(err)
+	}
+	if _, err := s.RemoveExpired(time.Now()); err != errNotSupported {
+		t.Error(err)
+	}
+	if _, err := s.GetClicks([]byte("1")); err != errNotSupported {
+		t.Error(err)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageCache_Conformance(t *testing.T) {
+	testMutableStorageConformance(t, NewStorageCache(NewStorageMap(), 10, 1000, time.Minute))
+}
+
+//nolint:deadcode,megacheck
+func TestStorageCache_ExpiringConformance(t *testing.T) {
+	testExpiringStorageConformance(t, NewStorageCache(NewStorageMap(), 10, 1000, time.Minute))
+}
+
+//nolint:deadcode,megacheck
+func TestStorageCache_ClickConformance(t *testing.T) {
+	testClickStorageConformance(t, NewStorageCache(NewStorageMap(), 10, 1000, time.Minute))
+}
+
+//nolint:deadcode,megacheck
+func TestStorageCache_DedupConformance(t *testing.T) {
+	testDedupStorageConformance(t, NewStorageCache(NewStorageMap(), 10, 1000, time.Minute))
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testMutableStorageConformance check common behaviour, which every MutableStorage backend has to implement.
+// Storage must be empty before the test.
+//
+//nolint:deadcode,megacheck
+func testMutableStorageConformance(t *testing.T, s MutableStorage) {
+	key, otherKey := []byte("conformance-key"), []byte("conformance-other-key")
+
+	if _, err := s.Get(key); err != errNoKey {
+		t.Error("Get missing:", err)
+	}
+	if exists, err := s.Exists(key); exists || err != nil {
+		t.Error("Exists missing:", exists, err)
+	}
+	if err := s.Delete(key); err != errNoKey {
+		t.Error("Delete missing:", err)
+	}
+	if err := s.Update(key, []byte("1"), []byte("2")); err != errNoKey {
+		t.Error("Update missing:", err)
+	}
+
+	if err := s.Store(key, []byte("first")); err != nil {
+		t.Error("Store:", err)
+	}
+	if err := s.Store(key, []byte("second")); err != errDuplicate {
+		t.Error("Store duplicate:", err)
+	}
+	if err := s.Store(otherKey, []byte("other")); err != nil {
+		t.Error("Store other:", err)
+	}
+	if val, err := s.Get(key); err != nil || string(val) != "first" {
+		t.Error("Get:", err, string(val))
+	}
+	if exists, err := s.Exists(key); !exists || err != nil {
+		t.Error("Exists:", exists, err)
+	}
+
+	if err := s.Update(key, []byte("wrong"), []byte("second")); err != errValueMismatch {
+		t.Error("Update mismatch:", err)
+	}
+	if val, err := s.Get(key); err != nil || string(val) != "first" {
+		t.Error("Get after update mismatch:", err, string(val))
+	}
+	if err := s.Update(key, []byte("first"), []byte("second")); err != nil {
+		t.Error("Update:", err)
+	}
+	if val, err := s.Get(key); err != nil || string(val) != "second" {
+		t.Error("Get after update:", err, string(val))
+	}
+
+	if err := s.Delete(key); err != nil {
+		t.Error("Delete:", err)
+	}
+	if _, err := s.Get(key); err != errNoKey {
+		t.Error("Get after delete:", err)
+	}
+	if exists, err := s.Exists(key); exists || err != nil {
+		t.Error("Exists after delete:", exists, err)
+	}
+	if val, err := s.Get(otherKey); err != nil || string(val) != "other" {
+		t.Error("Get other after delete:", err, string(val))
+	}
+	if err := s.Store(key, []byte("third")); err != nil {
+		t.Error("Store after delete:", err)
+	}
+	if val, err := s.Get(key); err != nil || string(val) != "third" {
+		t.Error("Get after store again:", err, string(val))
+	}
+}
+
+// testExpiringStorageConformance check common behaviour, which every ExpiringStorage backend has to implement.
+// Storage must be empty before the test.
+//
+//nolint:deadcode,megacheck
+func testExpiringStorageConformance(t *testing.T, s interface {
+	Storage
+	ExpiringStorage
+}) {
+	key, otherKey := []byte("conformance-expire-key"), []byte("conformance-expire-other-key")
+	const ttl = 200 * time.Millisecond
+
+	if err := s.StoreExpiring(key, []byte("first"), time.Now().Add(ttl)); err != nil {
+		t.Error("StoreExpiring:", err)
+	}
+	if err := s.StoreExpiring(key, []byte("second"), time.Now().Add(time.Hour)); err != errDuplicate {
+		t.Error("StoreExpiring duplicate:", err)
+	}
+	if err := s.Store(otherKey, []byte("other")); err != nil {
+		t.Error("Store:", err)
+	}
+	if val, err := s.Get(key); err != nil || string(val) != "first" {
+		t.Error("Get before expire:", err, string(val))
+	}
+	if _, err := s.RemoveExpired(time.Now()); err != nil {
+		t.Error("RemoveExpired before expire:", err)
+	}
+	if val, err := s.Get(key); err != nil || string(val) != "first" {
+		t.Error("Get after RemoveExpired before expire:", err, string(val))
+	}
+
+	time.Sleep(ttl + 50*time.Millisecond)
+
+	if _, err := s.RemoveExpired(time.Now()); err != nil {
+		t.Error("RemoveExpired:", err)
+	}
+	if _, err := s.Get(key); err != errNoKey {
+		t.Error("Get after expire:", err)
+	}
+	if val, err := s.Get(otherKey); err != nil || string(val) != "other" {
+		t.Error("Get other after expire:", err, string(val))
+	}
+	if err := s.Store(key, []byte("third")); err != nil {
+		t.Error("Store after expire:", err)
+	}
+}
+
+// testClickStorageConformance check common behaviour, which every ClickStorage backend has to implement.
+// Storage must be empty before the test.
+//
+//nolint:deadcode,megacheck
+func testClickStorageConformance(t *testing.T, s interface {
+	MutableStorage
+	ClickStorage
+}) {
+	key := []byte("conformance-clicks-key")
+	start := time.Unix(1500000000, 0).UTC()
+
+	if stats, err := s.GetClicks(key); err != nil || stats.Count != 0 {
+		t.Error("GetClicks missing:", err, stats)
+	}
+	if err := s.Store(key, []byte("value")); err != nil {
+		t.Error("Store:", err)
+	}
+
+	err := s.AddClicks(key, ClickStats{Count: 2, FirstAccess: start, LastAccess: start.Add(time.Second)})
+	if err != nil {
+		t.Error("AddClicks:", err)
+	}
+	err = s.AddClicks(key, ClickStats{Count: 3, FirstAccess: start.Add(time.Minute), LastAccess: start.Add(time.Hour)})
+	if err != nil {
+		t.Error("AddClicks second:", err)
+	}
+	stats, err := s.GetClicks(key)
+	if err != nil || stats.Count != 5 || !stats.FirstAccess.Equal(start) || !stats.LastAccess.Equal(start.Add(time.Hour)) {
+		t.Error("GetClicks:", err, stats)
+	}
+
+	// late batch doesn't move access times back
+	err = s.AddClicks(key, ClickStats{Count: 1, FirstAccess: start.Add(time.Minute), LastAccess: start.Add(time.Minute)})
+	if err != nil {
+		t.Error("AddClicks late:", err)
+	}
+	stats, err = s.GetClicks(key)
+	if err != nil || stats.Count != 6 || !stats.FirstAccess.Equal(start) || !stats.LastAccess.Equal(start.Add(time.Hour)) {
+		t.Error("GetClicks after late batch:", err, stats)
+	}
+
+	if err = s.Delete(key); err != nil {
+		t.Error("Delete:", err)
+	}
+	if stats, err = s.GetClicks(key); err != nil || stats.Count != 0 {
+		t.Error("GetClicks after delete:", err, stats)
+	}
+
+	// clicks, flushed after delete, are dropped
+	if err = s.AddClicks(key, ClickStats{Count: 1, FirstAccess: start, LastAccess: start}); err != nil {
+		t.Error("AddClicks after delete:", err)
+	}
+	if stats, err = s.GetClicks(key); err != nil || stats.Count != 0 {
+		t.Error("GetClicks after AddClicks of deleted key:", err, stats)
+	}
+}
+
+// testDedupStorageConformance check storeDedup with the storage: by DedupStorage if backend implements it and
+// by fallback otherwise. Storage must be empty before the test.
+//
+//nolint:deadcode,megacheck
+func testDedupStorageConformance(t *testing.T, s Storage) {
+	dedupKey, key := []byte("conformance-dedup/url"), []byte("conformance-dedup-key")
+
+	if existingKey, err := storeDedup(s, dedupKey, key, []byte("value")); existingKey != nil || err != nil {
+		t.Error("StoreDedup:", string(existingKey), err)
+	}
+	if val, err := s.Get(key); err != nil || string(val) != "value" {
+		t.Error("Get:", err, string(val))
+	}
+	if val, err := s.Get(dedupKey); err != nil || string(val) != string(key) {
+		t.Error("Get reverse index:", err, string(val))
+	}
+
+	otherKey := []byte("conformance-dedup-other-key")
+	if existingKey, err := storeDedup(s, dedupKey, otherKey, []byte("other")); string(existingKey) != string(key) || err != nil {
+		t.Error("StoreDedup existed:", string(existingKey), err)
+	}
+	if _, err := s.Get(otherKey); err != errNoKey {
+		t.Error("Get not saved:", err)
+	}
+
+	if _, err := storeDedup(s, []byte("conformance-dedup/other-url"), key, []byte("other")); err != errDuplicate {
+		t.Error("StoreDedup duplicate key:", err)
+	}
+
+	// concurrent calls for same url
+	const count = 10
+	concurrentDedupKey := []byte("conformance-dedup/concurrent-url")
+	results := make([]string, count)
+	var wg sync.WaitGroup
+	wg.Add(count)
+	for i := 0; i < count; i++ {
+		go func(i int) {
+			defer wg.Done()
+			itemKey := []byte("conformance-dedup-concurrent-" + strconv.Itoa(i))
+			existingKey, err := storeDedup(s, concurrentDedupKey, itemKey, []byte("value"))
+			if err != nil {
+				t.Error("StoreDedup concurrent:", err)
+			}
+			if existingKey == nil {
+				existingKey = itemKey
+			}
+			results[i] = string(existingKey)
+		}(i)
+	}
+	wg.Wait()
+	for i := range results {
+		if results[i] != results[0] {
+			t.Error("Concurrent StoreDedup results:", results)
+			break
+		}
+	}
+}
@@ -1,45 +1,356 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// StorageFiles save every item in separate file. Files are spread by two levels of subdirectories.
+// Update and Delete are atomic for goroutines of one process only.
 type StorageFiles struct {
 	Dir string
+
+	// Fsync sync files and directories to disk before return from write operations
+	Fsync bool
+
+	mutex *sync.Mutex
 }
 
+// storageFilesEncoding encode keys to file names. It is fixed and doesn't depend of id encoding for urls,
+// for keep names of existed files.
+var storageFilesEncoding = base64.RawURLEncoding
+
 func NewStorageFiles(dir string) StorageFiles {
 	if err := os.MkdirAll(dir, DEFAULT_DIR_MODE); err != nil {
 		panic(err)
 	}
-	return StorageFiles{Dir: dir}
+	return StorageFiles{Dir: dir, mutex: &sync.Mutex{}}
+}
+
+// fileName return path of item file: Dir/xx/yy/name.txt. Subdirectories are from hash of key instead of
+// prefix of the name because all aliases have common prefix.
+func (s StorageFiles) fileName(key []byte) string {
+	h := fnv.New32a()
+	//nolint:errcheck
+	h.Write(key)
+	sum := h.Sum32()
+	return filepath.Join(s.Dir, fmt.Sprintf("%02x", byte(sum>>8)), fmt.Sprintf("%02x", byte(sum)),
+		storageFilesEncoding.EncodeToString(key)+".txt")
+}
+
+// sidecarFileName return name of file with additional data of item: expiration time, clicks, etc.
+func (s StorageFiles) sidecarFileName(fileName, ext string) string {
+	return strings.TrimSuffix(fileName, ".txt") + ext
 }
 
 func (s StorageFiles) Store(key, value []byte) error {
-	fileName := filepath.Join(s.Dir, string(makeUrl(nil, key))+".txt")
-	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_EXCL, DEFAULT_FILE_MODE)
+	return s.store(key, value, time.Time{})
+}
+
+// StoreExpiring save expiration time (unix nanoseconds) in file near item file. It is written after item file
+// is created, so existed items never get expiration of duplicate.
+func (s StorageFiles) StoreExpiring(key, value []byte, expireAt time.Time) error {
+	return s.store(key, value, expireAt)
+}
+
+// store write value to temporary file and hard link it to item file name. Link fails if the item exists,
+// so readers never see partial item file and duplicates are detected without locks.
+func (s StorageFiles) store(key, value []byte, expireAt time.Time) error {
+	fileName := s.fileName(key)
+	dir := filepath.Dir(fileName)
+	if err := os.MkdirAll(dir, DEFAULT_DIR_MODE); err != nil {
+		return err
+	}
+
+	tmpName, err := writeTempFile(fileName, value, s.Fsync)
+	if err != nil {
+		return err
+	}
+	err = os.Link(tmpName, fileName)
+	if removeErr := os.Remove(tmpName); err == nil {
+		err = removeErr
+	}
 	if err != nil {
 		if os.IsExist(err) {
 			err = errDuplicate
 		}
 		return err
 	}
-	_, err = f.Write(value)
+	if s.Fsync {
+		if err = syncDir(dir); err != nil {
+			return err
+		}
+	}
+
+	if !expireAt.IsZero() {
+		err = writeFileAtomic(s.sidecarFileName(fileName, ".expire"), []byte(strconv.FormatInt(expireAt.UnixNano(), 10)), s.Fsync)
+		if err != nil {
+			//nolint:errcheck
+			os.Remove(fileName)
+			return err
+		}
+	}
+	return nil
+}
+
+func (s StorageFiles) Get(key []byte) (res []byte, err error) {
+	res, err = ioutil.ReadFile(s.fileName(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = errNoKey
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s StorageFiles) Delete(key []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.deleteLocked(s.fileName(key))
+}
+
+func (s StorageFiles) deleteLocked(fileName string) error {
+	err := os.Remove(fileName)
+	if os.IsNotExist(err) {
+		return errNoKey
+	}
 	if err != nil {
-		f.Close()
 		return err
 	}
-	err = f.Close()
-	return err
+	for _, ext := range []string{".expire", ".clicks"} {
+		err = os.Remove(s.sidecarFileName(fileName, ext))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s StorageFiles) Get(key []byte) (res []byte, err error) {
-	fileName := filepath.Join(s.Dir, string(makeUrl(nil, key))+".txt")
-	res, err = ioutil.ReadFile(fileName)
+// RemoveExpired scan all expiration files in storage dir.
+func (s StorageFiles) RemoveExpired(now time.Time) (int, error) {
+	expireFiles, err := filepath.Glob(filepath.Join(s.Dir, "*", "*", "*.expire"))
+	if err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, expireFileName := range expireFiles {
+		content, err := ioutil.ReadFile(expireFileName)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		expireAt, err := strconv.ParseInt(string(content), 10, 64)
+		if err != nil {
+			return count, fmt.Errorf("Bad expiration file '%v': %v", expireFileName, err)
+		}
+		if expireAt >= now.UnixNano() {
+			continue
+		}
+
+		fileName := strings.TrimSuffix(expireFileName, ".expire") + ".txt"
+		err = s.deleteLocked(fileName)
+		if err == errNoKey {
+			// item is removed already, remove orphan expiration file without count it
+			if err = os.Remove(expireFileName); err != nil && !os.IsNotExist(err) {
+				return count, err
+			}
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (s StorageFiles) Exists(key []byte) (bool, error) {
+	_, err := os.Stat(s.fileName(key))
+	if err == nil {
+		return true, nil
+	}
 	if os.IsNotExist(err) {
-		err = errNoKey
+		return false, nil
+	}
+	return false, err
+}
+
+// Update replace item file atomically by rename.
+func (s StorageFiles) Update(key, oldValue, newValue []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	val, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(val, oldValue) {
+		return errValueMismatch
+	}
+
+	return writeFileAtomic(s.fileName(key), newValue, s.Fsync)
+}
+
+// AddClicks keep stats in sidecar file: count, first and last access time (unix nanoseconds), separated by space.
+func (s StorageFiles) AddClicks(key []byte, stats ClickStats) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := os.Stat(s.fileName(key)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	saved, err := s.getClicks(key)
+	if err != nil {
+		return err
+	}
+	saved.Add(stats)
+	content := fmt.Sprintf("%d %d %d", saved.Count, saved.FirstAccess.UnixNano(), saved.LastAccess.UnixNano())
+	return writeFileAtomic(s.sidecarFileName(s.fileName(key), ".clicks"), []byte(content), s.Fsync)
+}
+
+func (s StorageFiles) GetClicks(key []byte) (ClickStats, error) {
+	return s.getClicks(key)
+}
+
+func (s StorageFiles) getClicks(key []byte) (ClickStats, error) {
+	clicksFileName := s.sidecarFileName(s.fileName(key), ".clicks")
+	content, err := ioutil.ReadFile(clicksFileName)
+	if os.IsNotExist(err) {
+		return ClickStats{}, nil
+	}
+	if err != nil {
+		return ClickStats{}, err
+	}
+
+	var count, firstAccess, lastAccess int64
+	if _, err = fmt.Sscanf(string(content), "%d %d %d", &count, &firstAccess, &lastAccess); err != nil {
+		return ClickStats{}, fmt.Errorf("Bad clicks file '%v': %v", clicksFileName, err)
+	}
+	return ClickStats{
+		Count:       count,
+		FirstAccess: time.Unix(0, firstAccess).UTC(),
+		LastAccess:  time.Unix(0, lastAccess).UTC(),
+	}, nil
+}
+
+// writeTempFile write content to new temporary file near fileName and return name of the temporary file.
+func writeTempFile(fileName string, content []byte, fsync bool) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	tmpName := f.Name()
+	_, err = f.Write(content)
+	if err == nil && fsync {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		//nolint:errcheck
+		os.Remove(tmpName)
+		return "", err
+	}
+	return tmpName, nil
+}
+
+// writeFileAtomic write content to temporary file and replace fileName by rename.
+// If fsync is true - the file and its directory are synced to disk before return.
+func writeFileAtomic(fileName string, content []byte, fsync bool) error {
+	tmpName, err := writeTempFile(fileName, content, fsync)
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmpName, fileName); err != nil {
+		//nolint:errcheck
+		os.Remove(tmpName)
+		return err
+	}
+	if fsync {
+		return syncDir(filepath.Dir(fileName))
+	}
+	return nil
+}
+
+// MigrateFlat move files of flat layout (all items directly in Dir, as was before subdirectories)
+// to subdirectories. Return count of moved items. Existed files in subdirectories are never overwritten.
+func (s StorageFiles) MigrateFlat() (int, error) {
+	itemFiles, err := filepath.Glob(filepath.Join(s.Dir, "*.txt"))
+	if err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, oldFileName := range itemFiles {
+		key, err := storageFilesEncoding.DecodeString(strings.TrimSuffix(filepath.Base(oldFileName), ".txt"))
+		if err != nil {
+			return count, fmt.Errorf("Bad name of item file '%v': %v", oldFileName, err)
+		}
+		newFileName := s.fileName(key)
+		if err = os.MkdirAll(filepath.Dir(newFileName), DEFAULT_DIR_MODE); err != nil {
+			return count, err
+		}
+
+		// hard link instead of rename for never overwrite existed item. Link remains from interrupted migration
+		// is the same file.
+		if err = os.Link(oldFileName, newFileName); err != nil {
+			if os.IsNotExist(err) {
+				// item is deleted while migration
+				continue
+			}
+			if !os.IsExist(err) {
+				return count, err
+			}
+			if !isSameFile(oldFileName, newFileName) {
+				return count, fmt.Errorf("Item '%v' already exists in '%v'", oldFileName, newFileName)
+			}
+		}
+		for _, ext := range []string{".expire", ".clicks"} {
+			err = os.Rename(s.sidecarFileName(oldFileName, ext), s.sidecarFileName(newFileName, ext))
+			if err != nil && !os.IsNotExist(err) {
+				return count, err
+			}
+		}
+		if err = os.Remove(oldFileName); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func isSameFile(fileName1, fileName2 string) bool {
+	stat1, err := os.Stat(fileName1)
+	if err != nil {
+		return false
+	}
+	stat2, err := os.Stat(fileName2)
+	if err != nil {
+		return false
 	}
-	return res, err
+	return os.SameFile(stat1, stat2)
 }
@@ -5,10 +5,13 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 var (
-	_ Storage = StorageFiles{}
+	_ MutableStorage  = StorageFiles{}
+	_ ExpiringStorage = StorageFiles{}
+	_ ClickStorage    = StorageFiles{}
 )
 
 //nolint:deadcode,megacheck,errcheck
@@ -24,10 +27,16 @@ func TestStorageFiles_Store(t *testing.T) {
 		t.Error(err)
 	}
 
-	val, err := ioutil.ReadFile(filepath.Join(tmpDir, string(makeUrl(nil, []byte("123")))+".txt"))
+	val, err := ioutil.ReadFile(filepath.Join(tmpDir, "63", "1b", "MTIz.txt"))
 	if err != nil || string(val) != "222" {
 		t.Error(err, string(val))
 	}
+
+	// temporary file removed
+	files, _ := filepath.Glob(filepath.Join(tmpDir, "63", "1b", "*"))
+	if len(files) != 1 {
+		t.Error(files)
+	}
 }
 
 //nolint:deadcode,megacheck,errcheck
@@ -53,7 +62,8 @@ func TestStorageFiles_Get(t *testing.T) {
 	}
 	defer os.RemoveAll(tmpDir)
 	s := NewStorageFiles(tmpDir)
-	ioutil.WriteFile(filepath.Join(tmpDir, string(makeUrl(nil, []byte("222")))+".txt"), []byte("234"), DEFAULT_FILE_MODE)
+	os.MkdirAll(filepath.Join(tmpDir, "81", "b5"), DEFAULT_DIR_MODE)
+	ioutil.WriteFile(filepath.Join(tmpDir, "81", "b5", "MjIy.txt"), []byte("234"), DEFAULT_FILE_MODE)
 	value, err := s.Get([]byte("222"))
 	if string(value) != "234" || err != nil {
 		t.Error(err, value)
@@ -73,3 +83,120 @@ func TestStorageFiles_GetNoKey(t *testing.T) {
 		t.Error(err, value)
 	}
 }
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageFiles_MigrateFlat(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	ioutil.WriteFile(filepath.Join(tmpDir, "MTIz.txt"), []byte("1"), DEFAULT_FILE_MODE)
+	ioutil.WriteFile(filepath.Join(tmpDir, "MTIz.expire"), []byte("1000"), DEFAULT_FILE_MODE)
+	ioutil.WriteFile(filepath.Join(tmpDir, "MjIy.txt"), []byte("2"), DEFAULT_FILE_MODE)
+
+	s := NewStorageFiles(tmpDir)
+	// interrupted migration
+	os.MkdirAll(filepath.Join(tmpDir, "81", "b5"), DEFAULT_DIR_MODE)
+	os.Link(filepath.Join(tmpDir, "MjIy.txt"), filepath.Join(tmpDir, "81", "b5", "MjIy.txt"))
+
+	count, err := s.MigrateFlat()
+	if count != 2 || err != nil {
+		t.Error(count, err)
+	}
+	if val, err := s.Get([]byte("123")); err != nil || string(val) != "1" {
+		t.Error(err, string(val))
+	}
+	if val, err := s.Get([]byte("222")); err != nil || string(val) != "2" {
+		t.Error(err, string(val))
+	}
+	if removed, err := s.RemoveExpired(time.Unix(0, 2000)); removed != 1 || err != nil {
+		t.Error(removed, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(tmpDir, "*.*")); len(files) != 0 {
+		t.Error(files)
+	}
+
+	// never overwrite items
+	ioutil.WriteFile(filepath.Join(tmpDir, "MjIy.txt"), []byte("3"), DEFAULT_FILE_MODE)
+	if _, err := s.MigrateFlat(); err == nil {
+		t.Error(err)
+	}
+	if val, err := s.Get([]byte("222")); err != nil || string(val) != "2" {
+		t.Error(err, string(val))
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageFiles_Conformance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	testMutableStorageConformance(t, NewStorageFiles(tmpDir))
+}
+
+//nolint:deadcode,megacheck
+func TestStorageFiles_FsyncConformance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	s := NewStorageFiles(tmpDir)
+	s.Fsync = true
+	testMutableStorageConformance(t, s)
+}
+
+//nolint:deadcode,megacheck
+func TestStorageFiles_ExpiringConformance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	testExpiringStorageConformance(t, NewStorageFiles(tmpDir))
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageFiles_RemoveExpiredOrphan(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	s := NewStorageFiles(tmpDir)
+
+	s.StoreExpiring([]byte("orphan"), []byte("1"), time.Unix(0, 1000))
+	s.StoreExpiring([]byte("expired"), []byte("2"), time.Unix(0, 1000))
+	// item file is removed, expiration file remains
+	os.Remove(s.fileName([]byte("orphan")))
+
+	if removed, err := s.RemoveExpired(time.Unix(0, 2000)); removed != 1 || err != nil {
+		t.Error(removed, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(tmpDir, "*", "*", "*.expire")); len(files) != 0 {
+		t.Error(files)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageFiles_ClickConformance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	testClickStorageConformance(t, NewStorageFiles(tmpDir))
+}
+
+//nolint:deadcode,megacheck
+func TestStorageFiles_DedupConformance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	testDedupStorageConformance(t, NewStorageFiles(tmpDir))
+}
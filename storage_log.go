@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	logOpPut    = 1
+	logOpDelete = 2
+	logOpClicks = 3
+
+	// crc32, op, expireAt, key length, value length
+	logRecordHeaderLen = 4 + 1 + 8 + 4 + 4
+
+	logClicksValueLen = 8 + 8 + 8
+
+	// lengths in header above the limits are corruption
+	logMaxKeyLen   = 1 << 20
+	logMaxValueLen = 1 << 30
+
+	// logRecoveryScanLimit limit bytes, which are read to check candidates of valid records after corrupted record
+	logRecoveryScanLimit = 64 * 1024 * 1024
+
+	// logCompactMinGarbage is minimal size of garbage in log for start compaction
+	logCompactMinGarbage = 1024 * 1024
+)
+
+var errLogRecordCorrupted = errors.New("Log record corrupted")
+
+// logRecord is item of append-only log.
+//
+// Binary format: crc32 (IEEE, of rest of record), op, expireAt (unix nanoseconds, 0 - without expiration),
+// key length, value length, key, value. Numbers are big endian, lengths are uint32.
+type logRecord struct {
+	Op       byte
+	ExpireAt int64
+	Key      []byte
+	Value    []byte
+}
+
+func (r logRecord) Len() int64 {
+	return int64(logRecordHeaderLen + len(r.Key) + len(r.Value))
+}
+
+func (r logRecord) Marshal() []byte {
+	res := make([]byte, r.Len())
+	res[4] = r.Op
+	binary.BigEndian.PutUint64(res[5:], uint64(r.ExpireAt))
+	binary.BigEndian.PutUint32(res[13:], uint32(len(r.Key)))
+	binary.BigEndian.PutUint32(res[17:], uint32(len(r.Value)))
+	copy(res[logRecordHeaderLen:], r.Key)
+	copy(res[logRecordHeaderLen+len(r.Key):], r.Value)
+	binary.BigEndian.PutUint32(res, crc32.ChecksumIEEE(res[4:]))
+	return res
+}
+
+// readLogRecord read next record. Return io.EOF if reader is at end and errLogRecordCorrupted for partial
+// or damaged record.
+func readLogRecord(r io.Reader) (logRecord, error) {
+	header := make([]byte, logRecordHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errLogRecordCorrupted
+		}
+		return logRecord{}, err
+	}
+
+	keyLen := binary.BigEndian.Uint32(header[13:])
+	valueLen := binary.BigEndian.Uint32(header[17:])
+	if keyLen > logMaxKeyLen || valueLen > logMaxValueLen {
+		return logRecord{}, errLogRecordCorrupted
+	}
+	body := make([]byte, keyLen+valueLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return logRecord{}, errLogRecordCorrupted
+	}
+
+	crc := crc32.NewIEEE()
+	//nolint:errcheck
+	crc.Write(header[4:])
+	//nolint:errcheck
+	crc.Write(body)
+	if crc.Sum32() != binary.BigEndian.Uint32(header) {
+		return logRecord{}, errLogRecordCorrupted
+	}
+
+	return logRecord{
+		Op:       header[4],
+		ExpireAt: int64(binary.BigEndian.Uint64(header[5:])),
+		Key:      body[:keyLen],
+		Value:    body[keyLen:],
+	}, nil
+}
+
+// logRecordFollows return true if valid record starts after start of corrupted record at offset. Then the file is
+// damaged in the middle and truncate would lose valid records. Otherwise the record is torn tail of interrupted
+// append and it can be truncated.
+// Candidates are checked by header first, body is read only if op and lengths are possible and the record fits
+// into the file. Return error if bodies of candidates take more than logRecoveryScanLimit bytes: the file can't be
+// checked and isn't truncated.
+func logRecordFollows(f io.ReaderAt, offset, fileSize int64) (bool, error) {
+	header := make([]byte, logRecordHeaderLen)
+	var scanned int64
+	for start := offset + 1; start+logRecordHeaderLen <= fileSize; start++ {
+		if _, err := f.ReadAt(header, start); err != nil {
+			return false, err
+		}
+		if op := header[4]; op != logOpPut && op != logOpDelete && op != logOpClicks {
+			continue
+		}
+		keyLen, valueLen := binary.BigEndian.Uint32(header[13:]), binary.BigEndian.Uint32(header[17:])
+		if keyLen > logMaxKeyLen || valueLen > logMaxValueLen {
+			continue
+		}
+		recordLen := logRecordHeaderLen + int64(keyLen) + int64(valueLen)
+		if start+recordLen > fileSize {
+			continue
+		}
+		if scanned += recordLen; scanned > logRecoveryScanLimit {
+			return false, fmt.Errorf("Checked %v bytes after corrupted record without result", logRecoveryScanLimit)
+		}
+		if _, err := readLogRecord(io.NewSectionReader(f, start, recordLen)); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// truncateTornLogTail truncate file at offset of corrupted record if it is torn tail. Return error with offset
+// if valid records follow the corrupted record.
+func truncateTornLogTail(f *os.File, offset int64) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	follows, err := logRecordFollows(f, offset, stat.Size())
+	if err != nil {
+		return fmt.Errorf("File '%v' corrupted at offset %v, can't check records after it: %v", f.Name(), offset, err)
+	}
+	if follows {
+		return fmt.Errorf("File '%v' corrupted at offset %v, valid records follow the corrupted record", f.Name(), offset)
+	}
+	log.Printf("File '%v' has torn record at offset %v, truncate it", f.Name(), offset)
+	return f.Truncate(offset)
+}
+
+func marshalLogClicks(stats ClickStats) []byte {
+	res := make([]byte, logClicksValueLen)
+	binary.BigEndian.PutUint64(res, uint64(stats.Count))
+	binary.BigEndian.PutUint64(res[8:], uint64(stats.FirstAccess.UnixNano()))
+	binary.BigEndian.PutUint64(res[16:], uint64(stats.LastAccess.UnixNano()))
+	return res
+}
+
+func unmarshalLogClicks(data []byte) (ClickStats, error) {
+	if len(data) != logClicksValueLen {
+		return ClickStats{}, errLogRecordCorrupted
+	}
+	return ClickStats{
+		Count:       int64(binary.BigEndian.Uint64(data)),
+		FirstAccess: time.Unix(0, int64(binary.BigEndian.Uint64(data[8:]))).UTC(),
+		LastAccess:  time.Unix(0, int64(binary.BigEndian.Uint64(data[16:]))).UTC(),
+	}, nil
+}
+
+type storageLogIndexItem struct {
+	valueOffset int64
+	valueLen    uint32
+	recordLen   int64
+	expireAt    int64
+}
+
+// StorageLog keep all items in one append-only file and index of values positions in memory.
+// Every change is appended to the file as new record, on start the index is restored by reading whole file.
+// Partial or damaged record at end of file (after crash) is truncated, storage isn't opened if damaged record
+// is followed by valid records. Old versions of items are removed
+// from the file by Compact.
+type StorageLog struct {
+	fileName string
+	fsync    bool
+
+	mutex   sync.RWMutex
+	f       *os.File
+	size    int64
+	garbage int64
+	index   map[string]storageLogIndexItem
+	clicks  map[string]ClickStats
+}
+
+// NewStorageLog open or create log file. If fsync is true - every write is synced to disk before return.
+func NewStorageLog(fileName string, fsync bool) *StorageLog {
+	if err := os.MkdirAll(filepath.Dir(fileName), DEFAULT_DIR_MODE); err != nil {
+		panic(err)
+	}
+	s := &StorageLog{fileName: fileName, fsync: fsync}
+	if err := s.open(); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// open read log file and restore index
+func (s *StorageLog) open() error {
+	f, err := os.OpenFile(s.fileName, os.O_CREATE|os.O_RDWR, DEFAULT_FILE_MODE)
+	if err != nil {
+		return err
+	}
+
+	s.f = f
+	s.size = 0
+	s.garbage = 0
+	s.index = make(map[string]storageLogIndexItem)
+	s.clicks = make(map[string]ClickStats)
+
+	reader := bufio.NewReader(f)
+	for {
+		record, err := readLogRecord(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err == errLogRecordCorrupted {
+			return truncateTornLogTail(f, s.size)
+		}
+		if err != nil {
+			return err
+		}
+		if err = s.applyRecord(record, s.size); err != nil {
+			return err
+		}
+		s.size += record.Len()
+	}
+}
+
+// applyRecord update index by record, which is located at offset of file
+func (s *StorageLog) applyRecord(record logRecord, offset int64) error {
+	keyString := string(record.Key)
+	if old, exist := s.index[keyString]; exist && record.Op != logOpClicks {
+		s.garbage += old.recordLen
+	}
+	if _, exist := s.clicks[keyString]; exist && record.Op != logOpPut {
+		// clicks record of key always has same length
+		s.garbage += logRecord{Key: record.Key, Value: make([]byte, logClicksValueLen)}.Len()
+	}
+
+	switch record.Op {
+	case logOpPut:
+		s.index[keyString] = storageLogIndexItem{
+			valueOffset: offset + logRecordHeaderLen + int64(len(record.Key)),
+			valueLen:    uint32(len(record.Value)),
+			recordLen:   record.Len(),
+			expireAt:    record.ExpireAt,
+		}
+	case logOpDelete:
+		delete(s.index, keyString)
+		delete(s.clicks, keyString)
+		s.garbage += record.Len()
+	case logOpClicks:
+		stats, err := unmarshalLogClicks(record.Value)
+		if err != nil {
+			return err
+		}
+		s.clicks[keyString] = stats
+	default:
+		return errLogRecordCorrupted
+	}
+	return nil
+}
+
+// appendRecords write records to end of file and apply them to index. Mutex must be locked.
+func (s *StorageLog) appendRecords(records ...logRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.Write(record.Marshal())
+	}
+	if _, err := s.f.WriteAt(buf.Bytes(), s.size); err != nil {
+		// partial write will be overwritten by next write or truncated on next open
+		return err
+	}
+	if s.fsync {
+		if err := s.f.Sync(); err != nil {
+			return err
+		}
+	}
+
+	for _, record := range records {
+		if err := s.applyRecord(record, s.size); err != nil {
+			return err
+		}
+		s.size += record.Len()
+	}
+	return nil
+}
+
+func (s *StorageLog) Store(key, value []byte) error {
+	return s.StoreExpiring(key, value, time.Time{})
+}
+
+func (s *StorageLog) StoreExpiring(key, value []byte, expireAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exist := s.index[string(key)]; exist {
+		return errDuplicate
+	}
+	return s.appendRecords(logRecord{Op: logOpPut, ExpireAt: logExpireAt(expireAt), Key: key, Value: value})
+}
+
+// StoreBatch write all new items by one write (and one fsync).
+func (s *StorageLog) StoreBatch(keys, values [][]byte) []error {
+	errs := make([]error, len(keys))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	records := make([]logRecord, 0, len(keys))
+	batchKeys := make(map[string]bool, len(keys))
+	for i, key := range keys {
+		if _, exist := s.index[string(key)]; exist || batchKeys[string(key)] {
+			errs[i] = errDuplicate
+			continue
+		}
+		batchKeys[string(key)] = true
+		records = append(records, logRecord{Op: logOpPut, Key: key, Value: values[i]})
+	}
+
+	if err := s.appendRecords(records...); err != nil {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+	}
+	return errs
+}
+
+// StoreDedup write item and reverse index item by one write.
+func (s *StorageLog) StoreDedup(dedupKey, key, value []byte) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if item, exist := s.index[string(dedupKey)]; exist {
+		existingKey := make([]byte, item.valueLen)
+		if _, err := s.f.ReadAt(existingKey, item.valueOffset); err != nil {
+			return nil, err
+		}
+		return existingKey, nil
+	}
+	if _, exist := s.index[string(key)]; exist {
+		return nil, errDuplicate
+	}
+	return nil, s.appendRecords(
+		logRecord{Op: logOpPut, Key: key, Value: value},
+		logRecord{Op: logOpPut, Key: dedupKey, Value: key},
+	)
+}
+
+func (s *StorageLog) Get(key []byte) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	item, exist := s.index[string(key)]
+	if !exist {
+		return nil, errNoKey
+	}
+	res := make([]byte, item.valueLen)
+	if _, err := s.f.ReadAt(res, item.valueOffset); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *StorageLog) Exists(key []byte) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, exist := s.index[string(key)]
+	return exist, nil
+}
+
+func (s *StorageLog) Delete(key []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exist := s.index[string(key)]; !exist {
+		return errNoKey
+	}
+	return s.appendRecords(logRecord{Op: logOpDelete, Key: key})
+}
+
+func (s *StorageLog) Update(key, oldValue, newValue []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, exist := s.index[string(key)]
+	if !exist {
+		return errNoKey
+	}
+	val := make([]byte, item.valueLen)
+	if _, err := s.f.ReadAt(val, item.valueOffset); err != nil {
+		return err
+	}
+	if !bytes.Equal(val, oldValue) {
+		return errValueMismatch
+	}
+	return s.appendRecords(logRecord{Op: logOpPut, ExpireAt: item.expireAt, Key: key, Value: newValue})
+}
+
+func (s *StorageLog) RemoveExpired(now time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var records []logRecord
+	for key, item := range s.index {
+		if item.expireAt != 0 && item.expireAt < now.UnixNano() {
+			records = append(records, logRecord{Op: logOpDelete, Key: []byte(key)})
+		}
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	if err := s.appendRecords(records...); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+func (s *StorageLog) AddClicks(key []byte, stats ClickStats) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exist := s.index[string(key)]; !exist {
+		return nil
+	}
+	saved := s.clicks[string(key)]
+	saved.Add(stats)
+	return s.appendRecords(logRecord{Op: logOpClicks, Key: key, Value: marshalLogClicks(saved)})
+}
+
+func (s *StorageLog) GetClicks(key []byte) (ClickStats, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.clicks[string(key)], nil
+}
+
+// Compact rewrite log file with actual records only if size of garbage is more than size of actual data.
+// Writes are blocked while compaction.
+func (s *StorageLog) Compact() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.garbage < logCompactMinGarbage || s.garbage < s.size-s.garbage {
+		return nil
+	}
+	return s.compactLocked()
+}
+
+func (s *StorageLog) compactLocked() error {
+	tmpName := s.fileName + ".compact"
+	tmp, err := os.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, DEFAULT_FILE_MODE)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+
+	err = func() error {
+		for key, item := range s.index {
+			value := make([]byte, item.valueLen)
+			if _, err := s.f.ReadAt(value, item.valueOffset); err != nil {
+				return err
+			}
+			record := logRecord{Op: logOpPut, ExpireAt: item.expireAt, Key: []byte(key), Value: value}
+			if _, err := writer.Write(record.Marshal()); err != nil {
+				return err
+			}
+		}
+		for key, stats := range s.clicks {
+			// stats of deleted keys, saved before AddClicks checked key
+			if _, exist := s.index[key]; !exist {
+				continue
+			}
+			record := logRecord{Op: logOpClicks, Key: []byte(key), Value: marshalLogClicks(stats)}
+			if _, err := writer.Write(record.Marshal()); err != nil {
+				return err
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		return tmp.Sync()
+	}()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, s.fileName)
+	}
+	if err != nil {
+		//nolint:errcheck
+		os.Remove(tmpName)
+		return err
+	}
+	if err = syncDir(filepath.Dir(s.fileName)); err != nil {
+		return err
+	}
+
+	//nolint:errcheck
+	s.f.Close()
+	return s.open()
+}
+
+// RunCompaction call Compact every interval. It never returns.
+func (s *StorageLog) RunCompaction(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.Compact(); err != nil {
+			log.Printf("Can't compact log storage '%v': %v", s.fileName, err)
+		}
+	}
+}
+
+func (s *StorageLog) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.f.Close()
+}
+
+func logExpireAt(expireAt time.Time) int64 {
+	if expireAt.IsZero() {
+		return 0
+	}
+	return expireAt.UnixNano()
+}
+
+// syncDir fsync directory for make rename in it durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
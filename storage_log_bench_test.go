@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+//nolint:deadcode,megacheck
+func BenchmarkStorageLog_Store(b *testing.B) {
+	benchmarkStorageLogStore(b, false)
+}
+
+//nolint:deadcode,megacheck
+func BenchmarkStorageLog_StoreFsync(b *testing.B) {
+	benchmarkStorageLogStore(b, true)
+}
+
+//nolint:deadcode,megacheck,errcheck
+func benchmarkStorageLogStore(b *testing.B, fsync bool) {
+	tmpDir, err := ioutil.TempDir("", "benchmark-log")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	s := NewStorageLog(filepath.Join(tmpDir, "storage.log"), fsync)
+	defer s.Close()
+
+	var goroutinesCount = benchmarkParalellism * runtime.GOMAXPROCS(-1)
+	keys := make([][][]byte, goroutinesCount)
+	vals := make([][][]byte, goroutinesCount)
+	var localMutex sync.Mutex
+
+	for i := 0; i < goroutinesCount; i++ {
+		keys[i], vals[i] = createBenchData(b.N)
+		for j := range keys[i] {
+			keys[i][j] = append(keys[i][j], byte(i))
+		}
+	}
+
+	b.SetParallelism(benchmarkParalellism)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		localMutex.Lock()
+		localKeys, localVals := keys[0], vals[0]
+		keys, vals = keys[1:], vals[1:]
+		localMutex.Unlock()
+
+		for pb.Next() {
+			s.Store(localKeys[0], localVals[0])
+			localKeys, localVals = localKeys[1:], localVals[1:]
+		}
+	})
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	_ MutableStorage  = &StorageLog{}
+	_ BatchStorage    = &StorageLog{}
+	_ ExpiringStorage = &StorageLog{}
+	_ ClickStorage    = &StorageLog{}
+	_ DedupStorage    = &StorageLog{}
+)
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageLog_Reopen(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	fileName := filepath.Join(tmpDir, "storage.log")
+
+	s := NewStorageLog(fileName, true)
+	s.Store([]byte("1"), []byte("one"))
+	s.Store([]byte("2"), []byte("two"))
+	s.Update([]byte("1"), []byte("one"), []byte("one-new"))
+	s.Delete([]byte("2"))
+	s.Close()
+
+	s = NewStorageLog(fileName, false)
+	defer s.Close()
+	if val, err := s.Get([]byte("1")); err != nil || string(val) != "one-new" {
+		t.Error(err, string(val))
+	}
+	if _, err := s.Get([]byte("2")); err != errNoKey {
+		t.Error(err)
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageLog_RecoverPartialTail(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	fileName := filepath.Join(tmpDir, "storage.log")
+
+	s := NewStorageLog(fileName, false)
+	s.Store([]byte("1"), []byte("one"))
+	s.Store([]byte("2"), []byte("two"))
+	s.Close()
+
+	stat, _ := os.Stat(fileName)
+	goodSize := logRecord{Op: logOpPut, Key: []byte("1"), Value: []byte("one")}.Len()
+	for _, size := range []int64{stat.Size() - 1, goodSize + logRecordHeaderLen - 1, goodSize + 2} {
+		os.Truncate(fileName, size)
+
+		s = NewStorageLog(fileName, false)
+		if val, err := s.Get([]byte("1")); err != nil || string(val) != "one" {
+			t.Error(size, err, string(val))
+		}
+		if _, err := s.Get([]byte("2")); err != errNoKey {
+			t.Error(size, err)
+		}
+		s.Close()
+
+		if stat, _ = os.Stat(fileName); stat.Size() != goodSize {
+			t.Error(size, stat.Size())
+		}
+	}
+
+	// new records are written after recovered part
+	s = NewStorageLog(fileName, false)
+	s.Store([]byte("3"), []byte("three"))
+	s.Close()
+	s = NewStorageLog(fileName, false)
+	defer s.Close()
+	if val, err := s.Get([]byte("3")); err != nil || string(val) != "three" {
+		t.Error(err, string(val))
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageLog_RecoverCorruptedRecord(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	fileName := filepath.Join(tmpDir, "storage.log")
+
+	s := NewStorageLog(fileName, false)
+	s.Store([]byte("1"), []byte("one"))
+	s.Store([]byte("2"), []byte("two"))
+	s.Close()
+
+	content, _ := ioutil.ReadFile(fileName)
+	content[len(content)-1] ^= 0xff
+	ioutil.WriteFile(fileName, content, DEFAULT_FILE_MODE)
+
+	s = NewStorageLog(fileName, false)
+	defer s.Close()
+	if _, err := s.Get([]byte("1")); err != nil {
+		t.Error(err)
+	}
+	if _, err := s.Get([]byte("2")); err != errNoKey {
+		t.Error(err)
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageLog_CorruptedRecordInMiddle(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	fileName := filepath.Join(tmpDir, "storage.log")
+
+	s := NewStorageLog(fileName, false)
+	s.Store([]byte("1"), []byte("one"))
+	s.Store([]byte("2"), []byte("two"))
+	s.Close()
+
+	content, _ := ioutil.ReadFile(fileName)
+	content[logRecordHeaderLen] ^= 0xff
+	ioutil.WriteFile(fileName, content, DEFAULT_FILE_MODE)
+
+	func() {
+		defer func() {
+			err := recover()
+			if err == nil || !strings.Contains(fmt.Sprint(err), "corrupted at offset 0") {
+				t.Error(err)
+			}
+		}()
+		NewStorageLog(fileName, false)
+	}()
+
+	// valid records aren't truncated
+	if stat, _ := os.Stat(fileName); stat.Size() != int64(len(content)) {
+		t.Error(stat.Size())
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestLogRecordFollows(t *testing.T) {
+	valid := logRecord{Op: logOpPut, Key: []byte("1"), Value: []byte("one")}.Marshal()
+
+	// zeros aren't records
+	garbage := make([]byte, 1024*1024)
+	if follows, err := logRecordFollows(bytes.NewReader(garbage), 0, int64(len(garbage))); follows || err != nil {
+		t.Error(follows, err)
+	}
+	content := append(append([]byte(nil), garbage...), valid...)
+	if follows, err := logRecordFollows(bytes.NewReader(content), 0, int64(len(content))); !follows || err != nil {
+		t.Error(follows, err)
+	}
+
+	// headers of long records with bad crc: checked bytes are limited
+	const valueLen = 1024 * 1024
+	garbage = make([]byte, 2*valueLen)
+	for i := 0; i+logRecordHeaderLen <= valueLen; i += logRecordHeaderLen {
+		garbage[i+4] = logOpPut
+		binary.BigEndian.PutUint32(garbage[i+17:], valueLen)
+	}
+	if follows, err := logRecordFollows(bytes.NewReader(garbage), 0, int64(len(garbage))); follows || err == nil {
+		t.Error(follows, err)
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageLog_Compact(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	fileName := filepath.Join(tmpDir, "storage.log")
+
+	s := NewStorageLog(fileName, false)
+	value := make([]byte, 1024)
+	for i := 0; i < 2*logCompactMinGarbage/len(value); i++ {
+		key := []byte(strconv.Itoa(i))
+		s.Store(key, value)
+		if i > 0 {
+			s.Delete(key)
+		}
+	}
+	s.AddClicks([]byte("0"), ClickStats{Count: 2})
+
+	if err = s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	stat, _ := os.Stat(fileName)
+	if stat.Size() != s.size || s.garbage != 0 || s.size > 2*int64(len(value)) {
+		t.Error(stat.Size(), s.size, s.garbage)
+	}
+	s.Close()
+
+	s = NewStorageLog(fileName, false)
+	defer s.Close()
+	if val, err := s.Get([]byte("0")); err != nil || len(val) != len(value) {
+		t.Error(err, len(val))
+	}
+	if stats, err := s.GetClicks([]byte("0")); err != nil || stats.Count != 2 {
+		t.Error(err, stats)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageLog_Conformance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	s := NewStorageLog(filepath.Join(tmpDir, "storage.log"), false)
+	defer s.Close()
+	testMutableStorageConformance(t, s)
+}
+
+//nolint:deadcode,megacheck
+func TestStorageLog_ExpiringConformance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	s := NewStorageLog(filepath.Join(tmpDir, "storage.log"), false)
+	defer s.Close()
+	testExpiringStorageConformance(t, s)
+}
+
+//nolint:deadcode,megacheck
+func TestStorageLog_ClickConformance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	s := NewStorageLog(filepath.Join(tmpDir, "storage.log"), false)
+	defer s.Close()
+	testClickStorageConformance(t, s)
+}
+
+//nolint:deadcode,megacheck
+func TestStorageLog_DedupConformance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	s := NewStorageLog(filepath.Join(tmpDir, "storage.log"), false)
+	defer s.Close()
+	testDedupStorageConformance(t, s)
+}
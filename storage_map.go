@@ -1,33 +1,82 @@
 package main
 
-import "sync"
+import (
+	"bytes"
+	"sync"
+	"time"
+)
 
 type StorageMap struct {
-	m map[string][]byte
-	mutex sync.RWMutex
+	m      map[string][]byte
+	expire map[string]time.Time
+	clicks map[string]ClickStats
+	mutex  sync.RWMutex
+
+	// persistence is nil for memory only storage
+	persistence *storageMapPersistence
 }
 
-func NewStorageMap()*StorageMap{
+func NewStorageMap() *StorageMap {
 	return &StorageMap{
-		m:make(map[string][]byte),
+		m:      make(map[string][]byte),
+		expire: make(map[string]time.Time),
+		clicks: make(map[string]ClickStats),
 	}
 }
 
-func (s *StorageMap) Store (key, value []byte)error {
-	keyString := string(key)
+func (s *StorageMap) Store(key, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.storeLocked(key, value, time.Time{})
+}
+
+func (s *StorageMap) StoreBatch(keys, values [][]byte) []error {
+	errs := make([]error, len(keys))
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	for i := range keys {
+		errs[i] = s.storeLocked(keys[i], values[i], time.Time{})
+	}
+	return errs
+}
+
+func (s *StorageMap) StoreDedup(dedupKey, key, value []byte) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if existingKey, exist := s.m[string(dedupKey)]; exist {
+		return existingKey, nil
+	}
+	if _, exist := s.m[string(key)]; exist {
+		return nil, errDuplicate
+	}
+	if err := s.storeLocked(key, value, time.Time{}); err != nil {
+		return nil, err
+	}
+	return nil, s.storeLocked(dedupKey, key, time.Time{})
+}
+
+func (s *StorageMap) storeLocked(key, value []byte, expireAt time.Time) error {
+	keyString := string(key)
 	if _, exist := s.m[keyString]; exist {
 		return errDuplicate
 	}
+	if err := s.journal(logRecord{Op: logOpPut, ExpireAt: logExpireAt(expireAt), Key: key, Value: value}); err != nil {
+		return err
+	}
+	if !expireAt.IsZero() {
+		s.expire[keyString] = expireAt
+	}
 	valCopy := make([]byte, len(value))
 	copy(valCopy, value)
 	s.m[keyString] = valCopy
 	return nil
 }
 
-func (s *StorageMap)Get(key []byte)(value []byte, err error){
+func (s *StorageMap) Get(key []byte) (value []byte, err error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -35,4 +84,100 @@ func (s *StorageMap)Get(key []byte)(value []byte, err error){
 		return val, nil
 	}
 	return nil, errNoKey
-}
\ No newline at end of file
+}
+
+func (s *StorageMap) Delete(key []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keyString := string(key)
+	if _, exist := s.m[keyString]; !exist {
+		return errNoKey
+	}
+	if err := s.journal(logRecord{Op: logOpDelete, Key: key}); err != nil {
+		return err
+	}
+	delete(s.m, keyString)
+	delete(s.expire, keyString)
+	delete(s.clicks, keyString)
+	return nil
+}
+
+func (s *StorageMap) Exists(key []byte) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, exist := s.m[string(key)]
+	return exist, nil
+}
+
+func (s *StorageMap) Update(key, oldValue, newValue []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keyString := string(key)
+	val, exist := s.m[keyString]
+	if !exist {
+		return errNoKey
+	}
+	if !bytes.Equal(val, oldValue) {
+		return errValueMismatch
+	}
+	if err := s.journal(logRecord{Op: logOpPut, ExpireAt: logExpireAt(s.expire[keyString]), Key: key, Value: newValue}); err != nil {
+		return err
+	}
+	valCopy := make([]byte, len(newValue))
+	copy(valCopy, newValue)
+	s.m[keyString] = valCopy
+	return nil
+}
+
+func (s *StorageMap) StoreExpiring(key, value []byte, expireAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.storeLocked(key, value, expireAt)
+}
+
+func (s *StorageMap) RemoveExpired(now time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for key, expireAt := range s.expire {
+		if expireAt.Before(now) {
+			if err := s.journal(logRecord{Op: logOpDelete, Key: []byte(key)}); err != nil {
+				return count, err
+			}
+			delete(s.m, key)
+			delete(s.expire, key)
+			delete(s.clicks, key)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *StorageMap) AddClicks(key []byte, stats ClickStats) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keyString := string(key)
+	if _, exist := s.m[keyString]; !exist {
+		return nil
+	}
+	saved := s.clicks[keyString]
+	saved.Add(stats)
+	if err := s.journal(logRecord{Op: logOpClicks, Key: key, Value: marshalLogClicks(saved)}); err != nil {
+		return err
+	}
+	s.clicks[keyString] = saved
+	return nil
+}
+
+func (s *StorageMap) GetClicks(key []byte) (ClickStats, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.clicks[string(key)], nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// StorageShardedMap spread items by independent StorageMap shards by hash of key,
+// so operations with different keys mostly don't wait each other.
+type StorageShardedMap struct {
+	shards []*StorageMap
+}
+
+func NewStorageShardedMap(shardsCount int) *StorageShardedMap {
+	if shardsCount < 1 {
+		shardsCount = 1
+	}
+	s := &StorageShardedMap{shards: make([]*StorageMap, shardsCount)}
+	for i := range s.shards {
+		s.shards[i] = NewStorageMap()
+	}
+	return s
+}
+
+func (s *StorageShardedMap) shardIndex(key []byte) int {
+	h := fnv.New32a()
+	//nolint:errcheck
+	h.Write(key)
+	return int(h.Sum32() % uint32(len(s.shards)))
+}
+
+func (s *StorageShardedMap) shard(key []byte) *StorageMap {
+	return s.shards[s.shardIndex(key)]
+}
+
+func (s *StorageShardedMap) Store(key, value []byte) error {
+	return s.shard(key).Store(key, value)
+}
+
+// StoreBatch group items by shards and store every group by one lock of shard.
+func (s *StorageShardedMap) StoreBatch(keys, values [][]byte) []error {
+	errs := make([]error, len(keys))
+	shardItems := make(map[int][]int)
+	for i, key := range keys {
+		index := s.shardIndex(key)
+		shardItems[index] = append(shardItems[index], i)
+	}
+
+	for index, items := range shardItems {
+		shardKeys := make([][]byte, len(items))
+		shardValues := make([][]byte, len(items))
+		for i, item := range items {
+			shardKeys[i], shardValues[i] = keys[item], values[item]
+		}
+		shardErrs := s.shards[index].StoreBatch(shardKeys, shardValues)
+		for i, item := range items {
+			errs[item] = shardErrs[i]
+		}
+	}
+	return errs
+}
+
+func (s *StorageShardedMap) Get(key []byte) ([]byte, error) {
+	return s.shard(key).Get(key)
+}
+
+func (s *StorageShardedMap) Delete(key []byte) error {
+	return s.shard(key).Delete(key)
+}
+
+func (s *StorageShardedMap) Exists(key []byte) (bool, error) {
+	return s.shard(key).Exists(key)
+}
+
+func (s *StorageShardedMap) Update(key, oldValue, newValue []byte) error {
+	return s.shard(key).Update(key, oldValue, newValue)
+}
+
+func (s *StorageShardedMap) StoreExpiring(key, value []byte, expireAt time.Time) error {
+	return s.shard(key).StoreExpiring(key, value, expireAt)
+}
+
+// RemoveExpired lock shards one by one.
+func (s *StorageShardedMap) RemoveExpired(now time.Time) (int, error) {
+	count := 0
+	for _, shard := range s.shards {
+		removed, err := shard.RemoveExpired(now)
+		count += removed
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+func (s *StorageShardedMap) AddClicks(key []byte, stats ClickStats) error {
+	return s.shard(key).AddClicks(key, stats)
+}
+
+func (s *StorageShardedMap) GetClicks(key []byte) (ClickStats, error) {
+	return s.shard(key).GetClicks(key)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// Benchmarks of storages, shared by all goroutines, for compare lock contention.
+
+//nolint:deadcode,megacheck
+func BenchmarkStorageMap_StoreShared(b *testing.B) {
+	benchmarkStorageStoreShared(b, NewStorageMap())
+}
+
+//nolint:deadcode,megacheck
+func BenchmarkStorageShardedMap_StoreShared(b *testing.B) {
+	benchmarkStorageStoreShared(b, NewStorageShardedMap(64))
+}
+
+//nolint:deadcode,megacheck
+func BenchmarkStorageMap_GetShared(b *testing.B) {
+	benchmarkStorageGetShared(b, NewStorageMap())
+}
+
+//nolint:deadcode,megacheck
+func BenchmarkStorageShardedMap_GetShared(b *testing.B) {
+	benchmarkStorageGetShared(b, NewStorageShardedMap(64))
+}
+
+//nolint:deadcode,megacheck
+func benchmarkStorageStoreShared(b *testing.B, s Storage) {
+	var counter int64
+	value := []byte("test-value")
+
+	b.SetParallelism(benchmarkParalellism)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := []byte(strconv.FormatInt(atomic.AddInt64(&counter, 1), 10))
+			if err := s.Store(key, value); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+//nolint:deadcode,megacheck
+func benchmarkStorageGetShared(b *testing.B, s Storage) {
+	const keysCount = 10000
+	keys := make([][]byte, keysCount)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i))
+		if err := s.Store(keys[i], []byte("test-value")); err != nil {
+			b.Fatal(err)
+		}
+	}
+	var counter int64
+
+	b.SetParallelism(benchmarkParalellism)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := s.Get(keys[atomic.AddInt64(&counter, 1)%keysCount]); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+)
+
+var (
+	_ MutableStorage  = NewStorageShardedMap(1)
+	_ BatchStorage    = NewStorageShardedMap(1)
+	_ ExpiringStorage = NewStorageShardedMap(1)
+	_ ClickStorage    = NewStorageShardedMap(1)
+)
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageShardedMap_StoreBatch(t *testing.T) {
+	s := NewStorageShardedMap(4)
+	s.Store([]byte("2"), []byte("old"))
+	keys := [][]byte{[]byte("1"), []byte("2"), []byte("1"), []byte("3"), []byte("4"), []byte("5")}
+	values := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e"), []byte("f")}
+	errs := s.StoreBatch(keys, values)
+	if len(errs) != 6 || errs[0] != nil || errs[1] != errDuplicate || errs[2] != errDuplicate ||
+		errs[3] != nil || errs[4] != nil || errs[5] != nil {
+		t.Error(errs)
+	}
+	for key, expected := range map[string]string{"1": "a", "2": "old", "3": "d", "4": "e", "5": "f"} {
+		if val, err := s.Get([]byte(key)); err != nil || string(val) != expected {
+			t.Error(key, err, string(val))
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageShardedMap_Conformance(t *testing.T) {
+	testMutableStorageConformance(t, NewStorageShardedMap(16))
+}
+
+//nolint:deadcode,megacheck
+func TestStorageShardedMap_ExpiringConformance(t *testing.T) {
+	testExpiringStorageConformance(t, NewStorageShardedMap(16))
+}
+
+//nolint:deadcode,megacheck
+func TestStorageShardedMap_ClickConformance(t *testing.T) {
+	testClickStorageConformance(t, NewStorageShardedMap(16))
+}
+
+//nolint:deadcode,megacheck
+func TestStorageShardedMap_DedupConformance(t *testing.T) {
+	testDedupStorageConformance(t, NewStorageShardedMap(16))
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Snapshot file of StorageMap: magic, version byte and records of log storage format (see logRecord):
+// logOpPut for every item and logOpClicks for click stats.
+var storageMapSnapshotMagic = []byte("URLSHORT-MAP")
+
+const storageMapSnapshotVersion = 1
+
+var errBadSnapshot = errors.New("Bad snapshot file")
+
+// storageMapPrevJournalSuffix is suffix of journal, which is closed at start of snapshot. It keeps changes before
+// the snapshot until the snapshot is saved.
+const storageMapPrevJournalSuffix = ".prev"
+
+// storageMapPersistence keep StorageMap on disk: snapshot of whole map and journal of changes after the snapshot.
+// Journal records set absolute state of key, so replay of journal over newer snapshot is harmless.
+// While snapshot is written, changes before the snapshot are kept in previous journal (journal file name with
+// storageMapPrevJournalSuffix), it is replayed before journal on restore.
+type storageMapPersistence struct {
+	snapshotFileName string
+	journalFileName  string
+	fsync            bool
+
+	// snapshotMutex serialize snapshots
+	snapshotMutex sync.Mutex
+
+	// journal is nil if journal is disabled. It is changed under StorageMap mutex.
+	journal     *os.File
+	journalSize int64
+}
+
+// NewStorageMapPersistent restore map from snapshot and journal and save snapshot of map on every Snapshot call.
+// If journalFileName is empty - changes between snapshots are lost on crash.
+// If fsync is true - every journal write is synced to disk before return.
+func NewStorageMapPersistent(snapshotFileName, journalFileName string, fsync bool) *StorageMap {
+	s := NewStorageMap()
+	s.persistence = &storageMapPersistence{
+		snapshotFileName: snapshotFileName,
+		journalFileName:  journalFileName,
+		fsync:            fsync,
+	}
+	if err := s.restore(); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *StorageMap) restore() error {
+	p := s.persistence
+	if err := os.MkdirAll(filepath.Dir(p.snapshotFileName), DEFAULT_DIR_MODE); err != nil {
+		return err
+	}
+
+	f, err := os.Open(p.snapshotFileName)
+	switch {
+	case os.IsNotExist(err):
+		// first start
+	case err != nil:
+		return err
+	default:
+		err = s.readSnapshot(bufio.NewReader(f))
+		//nolint:errcheck
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("Can't read snapshot '%v': %v", p.snapshotFileName, err)
+		}
+	}
+
+	if p.journalFileName == "" {
+		return nil
+	}
+	if err = os.MkdirAll(filepath.Dir(p.journalFileName), DEFAULT_DIR_MODE); err != nil {
+		return err
+	}
+
+	prevJournalFileName := p.journalFileName + storageMapPrevJournalSuffix
+	if _, err = os.Stat(prevJournalFileName); err == nil {
+		// interrupted snapshot
+		prevJournal, _, err := s.replayJournal(prevJournalFileName)
+		if err != nil {
+			return err
+		}
+		//nolint:errcheck
+		prevJournal.Close()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	p.journal, p.journalSize, err = s.replayJournal(p.journalFileName)
+	return err
+}
+
+// replayJournal apply records of journal file to map and return opened journal and size of its valid records.
+func (s *StorageMap) replayJournal(fileName string) (*os.File, int64, error) {
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DEFAULT_FILE_MODE)
+	if err != nil {
+		return nil, 0, err
+	}
+	var size int64
+	reader := bufio.NewReader(f)
+	for {
+		record, err := readLogRecord(reader)
+		if err == io.EOF {
+			return f, size, nil
+		}
+		if err == errLogRecordCorrupted {
+			if err = truncateTornLogTail(f, size); err == nil {
+				return f, size, nil
+			}
+		}
+		if err == nil {
+			err = s.applyRecord(record)
+		}
+		if err != nil {
+			//nolint:errcheck
+			f.Close()
+			return nil, 0, err
+		}
+		size += record.Len()
+	}
+}
+
+func (s *StorageMap) readSnapshot(reader io.Reader) error {
+	header := make([]byte, len(storageMapSnapshotMagic)+1)
+	if _, err := io.ReadFull(reader, header); err != nil || !bytes.Equal(header[:len(storageMapSnapshotMagic)], storageMapSnapshotMagic) {
+		return errBadSnapshot
+	}
+	if version := header[len(storageMapSnapshotMagic)]; version != storageMapSnapshotVersion {
+		return fmt.Errorf("Unsupported snapshot version: %v", version)
+	}
+
+	for {
+		record, err := readLogRecord(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = s.applyRecord(record); err != nil {
+			return err
+		}
+	}
+}
+
+// applyRecord set state of key from snapshot or journal record
+func (s *StorageMap) applyRecord(record logRecord) error {
+	keyString := string(record.Key)
+	switch record.Op {
+	case logOpPut:
+		s.m[keyString] = record.Value
+		if record.ExpireAt != 0 {
+			s.expire[keyString] = time.Unix(0, record.ExpireAt)
+		} else {
+			delete(s.expire, keyString)
+		}
+	case logOpDelete:
+		delete(s.m, keyString)
+		delete(s.expire, keyString)
+		delete(s.clicks, keyString)
+	case logOpClicks:
+		stats, err := unmarshalLogClicks(record.Value)
+		if err != nil {
+			return err
+		}
+		s.clicks[keyString] = stats
+	default:
+		return errLogRecordCorrupted
+	}
+	return nil
+}
+
+// journal append records to journal if it is enabled. Mutex must be locked.
+func (s *StorageMap) journal(records ...logRecord) error {
+	if s.persistence == nil || s.persistence.journal == nil {
+		return nil
+	}
+	p := s.persistence
+
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.Write(record.Marshal())
+	}
+	// write at known size: partial write of failed call is overwritten by next write
+	if _, err := p.journal.WriteAt(buf.Bytes(), p.journalSize); err != nil {
+		return err
+	}
+	if p.fsync {
+		if err := p.journal.Sync(); err != nil {
+			return err
+		}
+	}
+	p.journalSize += int64(buf.Len())
+	return nil
+}
+
+// Snapshot write whole map to snapshot file and remove journal of changes before the snapshot. Map is copied and
+// journal is switched under lock, file is written without lock, so reads and changes aren't blocked while snapshot.
+func (s *StorageMap) Snapshot() error {
+	if s.persistence == nil {
+		return nil
+	}
+	p := s.persistence
+
+	p.snapshotMutex.Lock()
+	defer p.snapshotMutex.Unlock()
+
+	// cut-over: copy contains all changes of closed journal, next changes are written to new journal
+	s.mutex.Lock()
+	snapshot := s.copyLocked()
+	err := p.rotateJournal()
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmpName := p.snapshotFileName + ".tmp"
+	err = snapshot.writeSnapshot(tmpName)
+	if err == nil {
+		err = os.Rename(tmpName, p.snapshotFileName)
+	}
+	if err != nil {
+		//nolint:errcheck
+		os.Remove(tmpName)
+		return err
+	}
+	if err = syncDir(filepath.Dir(p.snapshotFileName)); err != nil {
+		return err
+	}
+
+	if p.journalFileName == "" {
+		return nil
+	}
+	err = os.Remove(p.journalFileName + storageMapPrevJournalSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// copyLocked return copy of items, expiration times and click stats. Values are shared: they are never changed
+// in place. Mutex must be locked.
+func (s *StorageMap) copyLocked() *StorageMap {
+	res := NewStorageMap()
+	for key, value := range s.m {
+		res.m[key] = value
+	}
+	for key, expireAt := range s.expire {
+		res.expire[key] = expireAt
+	}
+	for key, stats := range s.clicks {
+		res.clicks[key] = stats
+	}
+	return res
+}
+
+// rotateJournal close journal as previous journal and start new empty journal. If previous journal remains from
+// failed snapshot, journal is appended to it instead. StorageMap mutex must be locked.
+func (p *storageMapPersistence) rotateJournal() error {
+	if p.journal == nil {
+		return nil
+	}
+	prevJournalFileName := p.journalFileName + storageMapPrevJournalSuffix
+
+	_, err := os.Stat(prevJournalFileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		prevJournal, err := os.OpenFile(prevJournalFileName, os.O_WRONLY|os.O_APPEND, DEFAULT_FILE_MODE)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(prevJournal, io.NewSectionReader(p.journal, 0, p.journalSize))
+		if err == nil {
+			err = prevJournal.Sync()
+		}
+		if closeErr := prevJournal.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		if err = p.journal.Truncate(0); err != nil {
+			return err
+		}
+		p.journalSize = 0
+		return p.journal.Sync()
+	}
+
+	if err = p.journal.Sync(); err != nil {
+		return err
+	}
+	if err = os.Rename(p.journalFileName, prevJournalFileName); err != nil {
+		return err
+	}
+	journal, err := os.OpenFile(p.journalFileName, os.O_CREATE|os.O_RDWR|os.O_TRUNC, DEFAULT_FILE_MODE)
+	if err != nil {
+		// keep writing to journal under its name
+		if renameErr := os.Rename(prevJournalFileName, p.journalFileName); renameErr != nil {
+			log.Printf("Can't rename previous journal '%v' back: %v", prevJournalFileName, renameErr)
+		}
+		return err
+	}
+	//nolint:errcheck
+	p.journal.Close()
+	p.journal = journal
+	p.journalSize = 0
+	return syncDir(filepath.Dir(p.journalFileName))
+}
+
+func (s *StorageMap) writeSnapshot(fileName string) error {
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, DEFAULT_FILE_MODE)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+
+	err = func() error {
+		if _, err := writer.Write(storageMapSnapshotMagic); err != nil {
+			return err
+		}
+		if err := writer.WriteByte(storageMapSnapshotVersion); err != nil {
+			return err
+		}
+		for key, value := range s.m {
+			record := logRecord{Op: logOpPut, ExpireAt: logExpireAt(s.expire[key]), Key: []byte(key), Value: value}
+			if _, err := writer.Write(record.Marshal()); err != nil {
+				return err
+			}
+		}
+		for key, stats := range s.clicks {
+			// stats of deleted keys, saved before AddClicks checked key
+			if _, exist := s.m[key]; !exist {
+				continue
+			}
+			record := logRecord{Op: logOpClicks, Key: []byte(key), Value: marshalLogClicks(stats)}
+			if _, err := writer.Write(record.Marshal()); err != nil {
+				return err
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// RunSnapshots call Snapshot every interval. It never returns.
+func (s *StorageMap) RunSnapshots(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.Snapshot(); err != nil {
+			log.Printf("Can't save snapshot of map storage: %v", err)
+		}
+	}
+}
+
+// Close save snapshot and close journal.
+func (s *StorageMap) Close() error {
+	if s.persistence == nil {
+		return nil
+	}
+	err := s.Snapshot()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.persistence.journal != nil {
+		if closeErr := s.persistence.journal.Close(); err == nil {
+			err = closeErr
+		}
+		s.persistence.journal = nil
+	}
+	return err
+}
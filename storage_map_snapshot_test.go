@@ -0,0 +1,216 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageMap_SnapshotRestore(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	snapshotFile := filepath.Join(tmpDir, "map.snapshot")
+	expireAt := time.Unix(2000000000, 0)
+	clickTime := time.Unix(1500000000, 0).UTC()
+
+	s := NewStorageMapPersistent(snapshotFile, "", false)
+	s.Store([]byte("1"), []byte("one"))
+	s.StoreExpiring([]byte("2"), []byte("two"), expireAt)
+	s.Store([]byte("3"), []byte("three"))
+	s.Delete([]byte("3"))
+	s.AddClicks([]byte("1"), ClickStats{Count: 3, FirstAccess: clickTime, LastAccess: clickTime})
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = NewStorageMapPersistent(snapshotFile, "", false)
+	if val, err := s.Get([]byte("1")); err != nil || string(val) != "one" {
+		t.Error(err, string(val))
+	}
+	if val, err := s.Get([]byte("2")); err != nil || string(val) != "two" || !s.expire["2"].Equal(expireAt) {
+		t.Error(err, string(val), s.expire)
+	}
+	if _, err := s.Get([]byte("3")); err != errNoKey {
+		t.Error(err)
+	}
+	if stats, _ := s.GetClicks([]byte("1")); stats.Count != 3 || !stats.FirstAccess.Equal(clickTime) {
+		t.Error(stats)
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageMap_JournalRestore(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	snapshotFile, journalFile := filepath.Join(tmpDir, "map.snapshot"), filepath.Join(tmpDir, "map.journal")
+
+	s := NewStorageMapPersistent(snapshotFile, journalFile, true)
+	s.Store([]byte("1"), []byte("one"))
+	s.Snapshot()
+	s.Store([]byte("2"), []byte("two"))
+	s.Update([]byte("1"), []byte("one"), []byte("one-new"))
+	// process killed: no snapshot on close
+
+	s = NewStorageMapPersistent(snapshotFile, journalFile, true)
+	if val, err := s.Get([]byte("1")); err != nil || string(val) != "one-new" {
+		t.Error(err, string(val))
+	}
+	if val, err := s.Get([]byte("2")); err != nil || string(val) != "two" {
+		t.Error(err, string(val))
+	}
+
+	// killed after snapshot is renamed, but before previous journal is removed: previous journal is replayed
+	// over the snapshot, which contains all its changes
+	s.Delete([]byte("2"))
+	s.Store([]byte("3"), []byte("three"))
+	prevJournal, _ := ioutil.ReadFile(journalFile)
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(journalFile+storageMapPrevJournalSuffix, prevJournal, DEFAULT_FILE_MODE)
+	s.Delete([]byte("3"))
+	s.Store([]byte("4"), []byte("four"))
+
+	s = NewStorageMapPersistent(snapshotFile, journalFile, true)
+	defer s.Close()
+	if val, err := s.Get([]byte("1")); err != nil || string(val) != "one-new" {
+		t.Error(err, string(val))
+	}
+	for _, key := range []string{"2", "3"} {
+		if val, err := s.Get([]byte(key)); err != errNoKey {
+			t.Error(key, err, string(val))
+		}
+	}
+	if val, err := s.Get([]byte("4")); err != nil || string(val) != "four" {
+		t.Error(err, string(val))
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageMap_SnapshotFailedKeepsJournal(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	snapshotFile, journalFile := filepath.Join(tmpDir, "map.snapshot"), filepath.Join(tmpDir, "map.journal")
+	prevJournalFile := journalFile + storageMapPrevJournalSuffix
+
+	// snapshot can't be written while not empty directory occupies name of temporary file
+	os.Mkdir(snapshotFile+".tmp", DEFAULT_DIR_MODE)
+	ioutil.WriteFile(filepath.Join(snapshotFile+".tmp", "busy"), nil, DEFAULT_FILE_MODE)
+
+	s := NewStorageMapPersistent(snapshotFile, journalFile, false)
+	s.Store([]byte("1"), []byte("one"))
+	if err = s.Snapshot(); err == nil {
+		t.Error("snapshot saved")
+	}
+	s.Store([]byte("2"), []byte("two"))
+	if err = s.Snapshot(); err == nil {
+		t.Error("snapshot saved")
+	}
+	s.Store([]byte("3"), []byte("three"))
+	if _, err = os.Stat(prevJournalFile); err != nil {
+		t.Error(err)
+	}
+
+	// crash without close
+	s = NewStorageMapPersistent(snapshotFile, journalFile, false)
+	for _, key := range []string{"1", "2", "3"} {
+		if _, err := s.Get([]byte(key)); err != nil {
+			t.Error(key, err)
+		}
+	}
+
+	os.RemoveAll(snapshotFile + ".tmp")
+	if err = s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(prevJournalFile); !os.IsNotExist(err) {
+		t.Error(err)
+	}
+	s.Store([]byte("4"), []byte("four"))
+
+	s = NewStorageMapPersistent(snapshotFile, journalFile, false)
+	defer s.Close()
+	for _, key := range []string{"1", "2", "3", "4"} {
+		if _, err := s.Get([]byte(key)); err != nil {
+			t.Error(key, err)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageMap_JournalTruncated(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	snapshotFile, journalFile := filepath.Join(tmpDir, "map.snapshot"), filepath.Join(tmpDir, "map.journal")
+
+	s := NewStorageMapPersistent(snapshotFile, journalFile, false)
+	s.Store([]byte("1"), []byte("one"))
+	s.Store([]byte("2"), []byte("two"))
+	journal, _ := ioutil.ReadFile(journalFile)
+	firstLen := int(logRecord{Key: []byte("1"), Value: []byte("one")}.Len())
+
+	// killed in the middle of write of second record
+	for size := firstLen; size < len(journal); size++ {
+		ioutil.WriteFile(journalFile, journal[:size], DEFAULT_FILE_MODE)
+
+		s = NewStorageMapPersistent(snapshotFile, journalFile, false)
+		if val, err := s.Get([]byte("1")); err != nil || string(val) != "one" {
+			t.Error(size, err, string(val))
+		}
+		if _, err := s.Get([]byte("2")); err != errNoKey {
+			t.Error(size, err)
+		}
+
+		// new records are written after restored part
+		s.Store([]byte("3"), []byte("three"))
+		s = NewStorageMapPersistent(snapshotFile, journalFile, false)
+		if val, err := s.Get([]byte("3")); err != nil || string(val) != "three" {
+			t.Error(size, err, string(val))
+		}
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageMap_SnapshotBadVersion(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	snapshotFile := filepath.Join(tmpDir, "map.snapshot")
+	ioutil.WriteFile(snapshotFile, append(storageMapSnapshotMagic, storageMapSnapshotVersion+1), DEFAULT_FILE_MODE)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Snapshot of unknown version restored")
+		}
+	}()
+	NewStorageMapPersistent(snapshotFile, "", false)
+}
+
+//nolint:deadcode,megacheck
+func TestStorageMap_PersistentConformance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "url-short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	s := NewStorageMapPersistent(filepath.Join(tmpDir, "map.snapshot"), filepath.Join(tmpDir, "map.journal"), false)
+	testMutableStorageConformance(t, s)
+	testClickStorageConformance(t, s)
+}
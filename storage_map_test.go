@@ -5,7 +5,11 @@ import (
 )
 
 var (
-	_ Storage = NewStorageMap()
+	_ MutableStorage  = NewStorageMap()
+	_ BatchStorage    = NewStorageMap()
+	_ ExpiringStorage = NewStorageMap()
+	_ ClickStorage    = NewStorageMap()
+	_ DedupStorage    = NewStorageMap()
 )
 
 //nolint:deadcode,megacheck
@@ -51,3 +55,36 @@ func TestStorageMap_GetNoKey(t *testing.T) {
 		t.Error(err, val)
 	}
 }
+
+//nolint:deadcode,megacheck
+func TestStorageMap_StoreBatch(t *testing.T) {
+	s := NewStorageMap()
+	s.m["2"] = []byte("old")
+	errs := s.StoreBatch([][]byte{[]byte("1"), []byte("2"), []byte("1")}, [][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	if len(errs) != 3 || errs[0] != nil || errs[1] != errDuplicate || errs[2] != errDuplicate {
+		t.Error(errs)
+	}
+	if string(s.m["1"]) != "a" || string(s.m["2"]) != "old" {
+		t.Error(s.m)
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageMap_Conformance(t *testing.T) {
+	testMutableStorageConformance(t, NewStorageMap())
+}
+
+//nolint:deadcode,megacheck
+func TestStorageMap_ExpiringConformance(t *testing.T) {
+	testExpiringStorageConformance(t, NewStorageMap())
+}
+
+//nolint:deadcode,megacheck
+func TestStorageMap_ClickConformance(t *testing.T) {
+	testClickStorageConformance(t, NewStorageMap())
+}
+
+//nolint:deadcode,megacheck
+func TestStorageMap_DedupConformance(t *testing.T) {
+	testDedupStorageConformance(t, NewStorageMap())
+}
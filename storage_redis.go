@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"strconv"
+	"time"
 
 	"github.com/mediocregopher/radix.v2/pool"
 	"github.com/mediocregopher/radix.v2/redis"
@@ -39,18 +41,232 @@ func NewStorageRedis(network, address string, database int) *StorageRedis {
 }
 
 func (s *StorageRedis) Store(key, value []byte) error {
-	resp := s.redisPool.Cmd("SET", key, value, "NX")
-	err := resp.Err
+	return redisStoreErr(s.redisPool.Cmd("SET", key, value, "NX"))
+}
+
+// StoreExpiring save item with PX option, redis removes it by itself.
+func (s *StorageRedis) StoreExpiring(key, value []byte, expireAt time.Time) error {
+	ttl := time.Until(expireAt) / time.Millisecond
+	if ttl <= 0 {
+		ttl = 1
+	}
+	return redisStoreErr(s.redisPool.Cmd("SET", key, value, "NX", "PX", int64(ttl)))
+}
+
+// RemoveExpired do nothing: redis removes expired keys by itself.
+func (s *StorageRedis) RemoveExpired(now time.Time) (int, error) {
+	return 0, nil
+}
+
+// StoreBatch send all items by pipeline in one connection.
+func (s *StorageRedis) StoreBatch(keys, values [][]byte) []error {
+	errs := make([]error, len(keys))
+	client, err := s.redisPool.Get()
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	defer s.redisPool.Put(client)
+
+	for i := range keys {
+		client.PipeAppend("SET", keys[i], values[i], "NX")
+	}
+	for i := range keys {
+		resp := client.PipeResp()
+		if resp.IsType(redis.IOErr) {
+			// connection broken, rest of answers will not be received
+			client.PipeClear()
+			for ; i < len(keys); i++ {
+				errs[i] = resp.Err
+			}
+			break
+		}
+		errs[i] = redisStoreErr(resp)
+	}
+	return errs
+}
+
+func redisStoreErr(resp *redis.Resp) error {
 	if resp.IsType(redis.Nil) {
 		return errDuplicate
 	}
-	return err
+	return resp.Err
 }
 
 func (s *StorageRedis) Get(key []byte) (value []byte, err error) {
 	resp := s.redisPool.Cmd("GET", key)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
 	if resp.IsType(redis.Nil) {
 		return nil, errNoKey
 	}
 	return resp.Bytes()
 }
+
+func (s *StorageRedis) Delete(key []byte) error {
+	deleted, err := s.redisPool.Cmd("DEL", key).Int()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errNoKey
+	}
+	return s.redisPool.Cmd("DEL", redisClicksKey(key)).Err
+}
+
+func (s *StorageRedis) Exists(key []byte) (bool, error) {
+	exists, err := s.redisPool.Cmd("EXISTS", key).Int()
+	return exists > 0, err
+}
+
+// redisUpdateScript return 0 if key doesn't exist, -1 if value doesn't match and 1 after update.
+// Expiration of key is kept.
+const redisUpdateScript = `
+local val = redis.call('GET', KEYS[1])
+if not val then
+	return 0
+end
+if val ~= ARGV[1] then
+	return -1
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ttl)
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`
+
+func (s *StorageRedis) Update(key, oldValue, newValue []byte) error {
+	res, err := s.redisPool.Cmd("EVAL", redisUpdateScript, 1, key, oldValue, newValue).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 0:
+		return errNoKey
+	case -1:
+		return errValueMismatch
+	default:
+		return nil
+	}
+}
+
+// redisStoreDedupScript save KEYS[2] = ARGV[1] and KEYS[1] = KEYS[2] if KEYS[1] doesn't exist.
+// Return {0} after save, {1, existing key} if KEYS[1] exists and {2} if KEYS[2] exists.
+const redisStoreDedupScript = `
+local existing = redis.call('GET', KEYS[1])
+if existing then
+	return {1, existing}
+end
+if not redis.call('SET', KEYS[2], ARGV[1], 'NX') then
+	return {2}
+end
+redis.call('SET', KEYS[1], KEYS[2])
+return {0}
+`
+
+func (s *StorageRedis) StoreDedup(dedupKey, key, value []byte) ([]byte, error) {
+	res, err := s.redisPool.Cmd("EVAL", redisStoreDedupScript, 2, dedupKey, key, value).Array()
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.New("Unexpected empty answer from redis")
+	}
+	code, err := res[0].Int()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case code == 1 && len(res) > 1:
+		return res[1].Bytes()
+	case code == 2:
+		return nil, errDuplicate
+	default:
+		return nil, nil
+	}
+}
+
+// LeaseCounter increment counterKey by INCRBY, so blocks of all instances are different.
+func (s *StorageRedis) LeaseCounter(n uint64) (uint64, error) {
+	end, err := s.redisPool.Cmd("INCRBY", counterKey, n).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(end) - n, nil
+}
+
+// redisClicksKeyPrefix separate click stats from items. Stats are saved in hash with fields count, first and last
+// (unix milliseconds).
+var redisClicksKeyPrefix = []byte("clicks/")
+
+func redisClicksKey(key []byte) []byte {
+	res := make([]byte, len(redisClicksKeyPrefix)+len(key))
+	copy(res, redisClicksKeyPrefix)
+	copy(res[len(redisClicksKeyPrefix):], key)
+	return res
+}
+
+// redisAddClicksScript merge stats into hash KEYS[1] and set same ttl as item KEYS[2] has. Stats of missed item
+// are removed.
+const redisAddClicksScript = `
+local ttl = redis.call('PTTL', KEYS[2])
+if ttl == -2 then
+	redis.call('DEL', KEYS[1])
+	return 0
+end
+redis.call('HINCRBY', KEYS[1], 'count', ARGV[1])
+local first = tonumber(redis.call('HGET', KEYS[1], 'first'))
+if first == nil or tonumber(ARGV[2]) < first then
+	redis.call('HSET', KEYS[1], 'first', ARGV[2])
+end
+local last = tonumber(redis.call('HGET', KEYS[1], 'last'))
+if last == nil or tonumber(ARGV[3]) > last then
+	redis.call('HSET', KEYS[1], 'last', ARGV[3])
+end
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+else
+	redis.call('PERSIST', KEYS[1])
+end
+return 1
+`
+
+func (s *StorageRedis) AddClicks(key []byte, stats ClickStats) error {
+	return s.redisPool.Cmd("EVAL", redisAddClicksScript, 2, redisClicksKey(key), key, stats.Count,
+		redisUnixMilliseconds(stats.FirstAccess), redisUnixMilliseconds(stats.LastAccess)).Err
+}
+
+func (s *StorageRedis) GetClicks(key []byte) (ClickStats, error) {
+	fields, err := s.redisPool.Cmd("HGETALL", redisClicksKey(key)).Map()
+	if err != nil {
+		return ClickStats{}, err
+	}
+	if len(fields) == 0 {
+		return ClickStats{}, nil
+	}
+
+	var res ClickStats
+	var first, last int64
+	if res.Count, err = strconv.ParseInt(fields["count"], 10, 64); err != nil {
+		return ClickStats{}, err
+	}
+	if first, err = strconv.ParseInt(fields["first"], 10, 64); err != nil {
+		return ClickStats{}, err
+	}
+	if last, err = strconv.ParseInt(fields["last"], 10, 64); err != nil {
+		return ClickStats{}, err
+	}
+	res.FirstAccess = time.Unix(0, first*int64(time.Millisecond)).UTC()
+	res.LastAccess = time.Unix(0, last*int64(time.Millisecond)).UTC()
+	return res, nil
+}
+
+func redisUnixMilliseconds(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
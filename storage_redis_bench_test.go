@@ -37,3 +37,25 @@ func BenchmarkStorageRedis_Store(b *testing.B) {
 		}
 	})
 }
+
+const benchmarkBatchSize = 100
+
+//nolint:deadcode,megacheck
+func BenchmarkStorageRedis_StoreBatch(b *testing.B) {
+	s := redisInit(b)
+	keys, vals := createBenchData(b.N)
+
+	b.ResetTimer()
+	for len(keys) > 0 {
+		batchSize := benchmarkBatchSize
+		if batchSize > len(keys) {
+			batchSize = len(keys)
+		}
+		for _, err := range s.StoreBatch(keys[:batchSize], vals[:batchSize]) {
+			if err != nil {
+				b.Error(err)
+			}
+		}
+		keys, vals = keys[batchSize:], vals[batchSize:]
+	}
+}
@@ -7,6 +7,14 @@ import (
 	"testing"
 )
 
+var (
+	_ MutableStorage  = &StorageRedis{}
+	_ BatchStorage    = &StorageRedis{}
+	_ ExpiringStorage = &StorageRedis{}
+	_ ClickStorage    = &StorageRedis{}
+	_ DedupStorage    = &StorageRedis{}
+)
+
 const (
 	TEST_REDIS_SERVER_NETWORK = "tcp"
 	TEST_REDIS_ADDRESS        = "127.0.0.1:6379"
@@ -85,3 +93,39 @@ func TestStorageRedis_GetNoKey(t *testing.T) {
 		t.Error(err, string(val))
 	}
 }
+
+//nolint:deadcode,megacheck
+func TestStorageRedis_StoreBatch(t *testing.T) {
+	s := redisInit(t)
+	s.redisPool.Cmd("SET", "2", "old")
+	errs := s.StoreBatch([][]byte{[]byte("1"), []byte("2"), []byte("1")}, [][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	if len(errs) != 3 || errs[0] != nil || errs[1] != errDuplicate || errs[2] != errDuplicate {
+		t.Error(errs)
+	}
+	for key, expected := range map[string]string{"1": "a", "2": "old"} {
+		val, err := s.Get([]byte(key))
+		if err != nil || string(val) != expected {
+			t.Error(key, err, string(val))
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageRedis_Conformance(t *testing.T) {
+	testMutableStorageConformance(t, redisInit(t))
+}
+
+//nolint:deadcode,megacheck
+func TestStorageRedis_ExpiringConformance(t *testing.T) {
+	testExpiringStorageConformance(t, redisInit(t))
+}
+
+//nolint:deadcode,megacheck
+func TestStorageRedis_ClickConformance(t *testing.T) {
+	testClickStorageConformance(t, redisInit(t))
+}
+
+//nolint:deadcode,megacheck
+func TestStorageRedis_DedupConformance(t *testing.T) {
+	testDedupStorageConformance(t, redisInit(t))
+}
@@ -1,14 +1,52 @@
 package main
 
-import "github.com/tarantool/go-tarantool"
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/tarantool/go-tarantool"
+)
 
 const (
 	ER_TUPLE_FOUND = 3
+
+	tarantoolStatsSpaceSuffix = "_stats"
+
+	// tarantoolExpireIndex is secondary index by expiration time (third field), it is created on connect.
+	// Field is nullable: tuples, saved before expiration was introduced, have no the field.
+	tarantoolExpireIndex = "expire_at"
 )
 
+// tarantoolCreateExpireIndexScript create index by expiration time if it doesn't exist
+const tarantoolCreateExpireIndexScript = `
+local space, name = ...
+box.space[space]:create_index(name, {
+	type = 'tree',
+	unique = false,
+	if_not_exists = true,
+	parts = {{3, 'unsigned', is_nullable = true}},
+})
+`
+
+// StorageTarantool save items in space and click stats in space with "_stats" suffix.
+// Spaces have to have primary index by first field. Index by expiration time is created on connect.
+// Stats space is optional: click stats are disabled if it doesn't exist.
 type StorageTarantool struct {
 	conn  *tarantool.Connection
 	space string
+
+	// statsSpace is empty if stats space doesn't exist
+	statsSpace string
+}
+
+type tarantoolClicksTuple struct {
+	//nolint:structcheck,megacheck
+	_msgpack    struct{} `msgpack:",asArray"`
+	ID          string
+	Count       int64
+	FirstAccess int64
+	LastAccess  int64
 }
 
 type tarantoolTuple struct {
@@ -16,6 +54,10 @@ type tarantoolTuple struct {
 	_msgpack struct{} `msgpack:",asArray"`
 	ID       string
 	Value    []byte
+
+	// ExpireAt is unix time in nanoseconds, 0 for items without expiration. Tuples, saved before expiration
+	// was introduced, have no the field.
+	ExpireAt int64
 }
 
 func NewStorageTarantool(host, user, password, space string) *StorageTarantool {
@@ -31,24 +73,118 @@ func NewStorageTarantool(host, user, password, space string) *StorageTarantool {
 	if err != nil {
 		panic(err)
 	}
+	if _, err = conn.Eval(tarantoolCreateExpireIndexScript, []interface{}{space, tarantoolExpireIndex}); err != nil {
+		panic(err)
+	}
+
+	statsSpace := space + tarantoolStatsSpaceSuffix
+	if _, exist := conn.Schema.Spaces[statsSpace]; !exist {
+		log.Printf("Tarantool space '%v' doesn't exist, click stats are disabled", statsSpace)
+		statsSpace = ""
+	}
 
 	return &StorageTarantool{
-		conn:  conn,
-		space: space,
+		conn:       conn,
+		space:      space,
+		statsSpace: statsSpace,
 	}
 }
 
+// HasStats return false if click stats are disabled because stats space doesn't exist
+func (s *StorageTarantool) HasStats() bool {
+	return s.statsSpace != ""
+}
+
 func (s *StorageTarantool) Store(key, value []byte) error {
 	tuple := tarantoolTuple{
 		ID:    string(key),
 		Value: value,
 	}
 	_, err := s.conn.Insert(s.space, tuple)
+	return tarantoolStoreErr(err)
+}
+
+// StoreExpiring save expiration time in third field of tuple, expired tuples are removed by RemoveExpired.
+func (s *StorageTarantool) StoreExpiring(key, value []byte, expireAt time.Time) error {
+	tuple := tarantoolTuple{
+		ID:       string(key),
+		Value:    value,
+		ExpireAt: expireAt.UnixNano(),
+	}
+	_, err := s.conn.Insert(s.space, tuple)
+	return tarantoolStoreErr(err)
+}
+
+// tarantoolRemoveExpiredScript delete expired tuples and return count of deleted tuples. Tuples are found by range
+// of expire_at index in batches of limit tuples, fiber yields between batches, so other requests aren't blocked
+// by sweep of many tuples.
+const tarantoolRemoveExpiredScript = `
+local space, statsSpace, indexName, now, limit = ...
+local fiber = require('fiber')
+local index = box.space[space].index[indexName]
+local total = 0
+while true do
+	local keys = {}
+	for _, t in index:pairs({0}, {iterator = 'GT'}) do
+		if t[3] >= now or #keys >= limit then
+			break
+		end
+		table.insert(keys, t[1])
+	end
+	box.begin()
+	for _, key in ipairs(keys) do
+		box.space[space]:delete(key)
+		if statsSpace ~= '' then
+			box.space[statsSpace]:delete(key)
+		end
+	end
+	box.commit()
+	total = total + #keys
+	if #keys < limit then
+		return total
+	end
+	fiber.yield()
+end
+`
+
+const tarantoolRemoveExpiredLimit = 100
+
+func (s *StorageTarantool) RemoveExpired(now time.Time) (int, error) {
+	var res []int
+	err := s.conn.EvalTyped(tarantoolRemoveExpiredScript,
+		[]interface{}{s.space, s.statsSpace, tarantoolExpireIndex, now.UnixNano(), tarantoolRemoveExpiredLimit}, &res)
 	if err != nil {
-		if tarantoolErr, ok := err.(tarantool.Error); ok {
-			if tarantoolErr.Code == ER_TUPLE_FOUND {
-				err = errDuplicate
-			}
+		return 0, err
+	}
+	if len(res) == 0 {
+		return 0, errors.New("Unexpected empty answer from tarantool")
+	}
+	return res[0], nil
+}
+
+// StoreBatch send all inserts asynchronously and wait answers after that.
+func (s *StorageTarantool) StoreBatch(keys, values [][]byte) []error {
+	futures := make([]*tarantool.Future, len(keys))
+	for i := range keys {
+		tuple := tarantoolTuple{
+			ID:    string(keys[i]),
+			Value: values[i],
+		}
+		futures[i] = s.conn.InsertAsync(s.space, tuple)
+	}
+
+	errs := make([]error, len(keys))
+	for i, future := range futures {
+		_, err := future.Get()
+		errs[i] = tarantoolStoreErr(err)
+	}
+	return errs
+}
+
+func tarantoolStoreErr(err error) error {
+	if tarantoolErr, ok := err.(tarantool.Error); ok {
+		if tarantoolErr.Code == ER_TUPLE_FOUND {
+			return errDuplicate
 		}
 	}
 	return err
@@ -67,6 +203,208 @@ func (s *StorageTarantool) Get(key []byte) (value []byte, err error) {
 	return items[0].Value, nil
 }
 
+// tarantoolDeleteScript delete item and its stats in one transaction. Return 0 if key doesn't exist and 1 after delete.
+const tarantoolDeleteScript = `
+local space, statsSpace, key = ...
+box.begin()
+local t = box.space[space]:delete(key)
+if t ~= nil and statsSpace ~= '' then
+	box.space[statsSpace]:delete(key)
+end
+box.commit()
+if t == nil then
+	return 0
+end
+return 1
+`
+
+func (s *StorageTarantool) Delete(key []byte) error {
+	var res []int
+	err := s.conn.EvalTyped(tarantoolDeleteScript, []interface{}{s.space, s.statsSpace, string(key)}, &res)
+	if err != nil {
+		return err
+	}
+	if len(res) == 0 {
+		return errors.New("Unexpected empty answer from tarantool")
+	}
+	if res[0] == 0 {
+		return errNoKey
+	}
+	return nil
+}
+
+func (s *StorageTarantool) Exists(key []byte) (bool, error) {
+	_, err := s.Get(key)
+	switch err {
+	case nil:
+		return true, nil
+	case errNoKey:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// tarantoolUpdateScript return 0 if key doesn't exist, -1 if value doesn't match and 1 after update.
+// Script doesn't yield, so it is executed atomically.
+const tarantoolUpdateScript = `
+local space, key, old, new = ...
+local t = box.space[space]:get(key)
+if t == nil then
+	return 0
+end
+if t[2] ~= old then
+	return -1
+end
+box.space[space]:update(key, {{'=', 2, new}})
+return 1
+`
+
+func (s *StorageTarantool) Update(key, oldValue, newValue []byte) error {
+	var res []int
+	err := s.conn.EvalTyped(tarantoolUpdateScript, []interface{}{s.space, string(key), oldValue, newValue}, &res)
+	if err != nil {
+		return err
+	}
+	if len(res) == 0 {
+		return errors.New("Unexpected empty answer from tarantool")
+	}
+	switch res[0] {
+	case 0:
+		return errNoKey
+	case -1:
+		return errValueMismatch
+	default:
+		return nil
+	}
+}
+
+// tarantoolStoreDedupScript save item and reverse index item if reverse index item doesn't exist.
+// Return {0} after save, {1, existing key} if reverse index item exists and {2} if item exists.
+// Checks don't yield, so concurrent calls can't save same reverse index item.
+const tarantoolStoreDedupScript = `
+local space, dedupKey, key, value = ...
+local existing = box.space[space]:get(dedupKey)
+if existing ~= nil then
+	return {1, existing[2]}
+end
+if box.space[space]:get(key) ~= nil then
+	return {2, ''}
+end
+box.begin()
+box.space[space]:insert{key, value, 0}
+box.space[space]:insert{dedupKey, key, 0}
+box.commit()
+return {0, ''}
+`
+
+type tarantoolStoreDedupResult struct {
+	//nolint:structcheck,megacheck
+	_msgpack    struct{} `msgpack:",asArray"`
+	Code        int
+	ExistingKey string
+}
+
+func (s *StorageTarantool) StoreDedup(dedupKey, key, value []byte) ([]byte, error) {
+	var res []tarantoolStoreDedupResult
+	err := s.conn.EvalTyped(tarantoolStoreDedupScript, []interface{}{s.space, string(dedupKey), string(key), value}, &res)
+	if err != nil {
+		return nil, tarantoolStoreErr(err)
+	}
+	if len(res) == 0 {
+		return nil, errors.New("Unexpected empty answer from tarantool")
+	}
+	switch res[0].Code {
+	case 1:
+		return []byte(res[0].ExistingKey), nil
+	case 2:
+		return nil, errDuplicate
+	default:
+		return nil, nil
+	}
+}
+
+// tarantoolLeaseCounterScript add n to counter item {key, counter, 0} and return new value of counter. Update is
+// atomic, insert of first value is retried as update if concurrent call inserted it first.
+const tarantoolLeaseCounterScript = `
+local space, key, n = ...
+local tuple = box.space[space]:update(key, {{'+', 2, n}})
+if tuple == nil then
+	local ok = pcall(box.space[space].insert, box.space[space], {key, n, 0})
+	if ok then
+		return n
+	end
+	tuple = box.space[space]:update(key, {{'+', 2, n}})
+end
+return tuple[2]
+`
+
+// LeaseCounter keep counter as item with key counterKey in the space of storage.
+func (s *StorageTarantool) LeaseCounter(n uint64) (uint64, error) {
+	var res []uint64
+	err := s.conn.EvalTyped(tarantoolLeaseCounterScript, []interface{}{s.space, string(counterKey), n}, &res)
+	if err != nil {
+		return 0, err
+	}
+	if len(res) == 0 {
+		return 0, errors.New("Unexpected empty answer from tarantool")
+	}
+	return res[0] - n, nil
+}
+
+// tarantoolAddClicksScript merge stats if item exists: increment counter, keep earliest first access and latest
+// last access, so late batch doesn't move them back. Times are compared by operators: nanoseconds are int64 cdata
+// in Lua, math.min and math.max don't accept them. Script doesn't yield, so stats can't be added after delete
+// of item and between read and write of stats.
+const tarantoolAddClicksScript = `
+local space, statsSpace, key, count, firstAccess, lastAccess = ...
+if box.space[space]:get(key) == nil then
+	return 0
+end
+local old = box.space[statsSpace]:get(key)
+if old == nil then
+	box.space[statsSpace]:insert({key, count, firstAccess, lastAccess})
+	return 1
+end
+if old[3] < firstAccess then
+	firstAccess = old[3]
+end
+if old[4] > lastAccess then
+	lastAccess = old[4]
+end
+box.space[statsSpace]:update(key, {{'+', 2, count}, {'=', 3, firstAccess}, {'=', 4, lastAccess}})
+return 1
+`
+
+func (s *StorageTarantool) AddClicks(key []byte, stats ClickStats) error {
+	if !s.HasStats() {
+		return errNotSupported
+	}
+	_, err := s.conn.Eval(tarantoolAddClicksScript, []interface{}{s.space, s.statsSpace, string(key), stats.Count,
+		stats.FirstAccess.UnixNano(), stats.LastAccess.UnixNano()})
+	return err
+}
+
+func (s *StorageTarantool) GetClicks(key []byte) (ClickStats, error) {
+	if !s.HasStats() {
+		return ClickStats{}, errNotSupported
+	}
+	var items []tarantoolClicksTuple
+	err := s.conn.SelectTyped(s.statsSpace, "primary", 0, 1,
+		tarantool.IterEq, tarantool.StringKey{S: string(key)}, &items)
+	if err != nil {
+		return ClickStats{}, err
+	}
+	if len(items) == 0 {
+		return ClickStats{}, nil
+	}
+	return ClickStats{
+		Count:       items[0].Count,
+		FirstAccess: time.Unix(0, items[0].FirstAccess).UTC(),
+		LastAccess:  time.Unix(0, items[0].LastAccess).UTC(),
+	}, nil
+}
+
 func (s *StorageTarantool) Close() error {
 	return s.conn.Close()
 }
@@ -1,11 +1,21 @@
 package main
 
 import (
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/tarantool/go-tarantool"
 )
 
+var (
+	_ MutableStorage  = &StorageTarantool{}
+	_ BatchStorage    = &StorageTarantool{}
+	_ ExpiringStorage = &StorageTarantool{}
+	_ ClickStorage    = &StorageTarantool{}
+	_ DedupStorage    = &StorageTarantool{}
+)
+
 const (
 	TEST_TARANTOOL_SERVER   = "localhost:3301"
 	TEST_TARANTOOL_USER     = "admin"
@@ -16,26 +26,28 @@ const (
 //nolint:deadcode,megacheck,errcheck
 func tarantoolTestInit() *StorageTarantool {
 	s := NewStorageTarantool(TEST_TARANTOOL_SERVER, TEST_TARANTOOL_USER, TEST_TARANTOOL_PASSWORD, TEST_TARANTOOL_SPACE)
-	if space, exist := s.conn.Schema.Spaces[TEST_TARANTOOL_SPACE]; exist {
-		_, err := s.conn.Call("box.schema.space.drop", []interface{}{space.Id})
-		if err != nil {
-			panic(err)
+	for _, spaceName := range []string{TEST_TARANTOOL_SPACE, TEST_TARANTOOL_SPACE + tarantoolStatsSpaceSuffix} {
+		if space, exist := s.conn.Schema.Spaces[spaceName]; exist {
+			_, err := s.conn.Call("box.schema.space.drop", []interface{}{space.Id})
+			if err != nil {
+				panic(err)
+			}
 		}
-	}
 
-	s.conn.Call("box.schema.space.create", []interface{}{TEST_TARANTOOL_SPACE})
+		s.conn.Call("box.schema.space.create", []interface{}{spaceName})
 
-	createIndexTuple := struct {
-		Type  string        `msgpack:"type"`
-		Parts []interface{} `msgpack:"parts"`
-	}{
-		Type:  "hash",
-		Parts: []interface{}{1, "string"},
-	}
+		createIndexTuple := struct {
+			Type  string        `msgpack:"type"`
+			Parts []interface{} `msgpack:"parts"`
+		}{
+			Type:  "hash",
+			Parts: []interface{}{1, "string"},
+		}
 
-	_, err := s.conn.Call("box.space."+TEST_TARANTOOL_SPACE+":create_index", []interface{}{"primary", createIndexTuple})
-	if err != nil {
-		panic(err)
+		_, err := s.conn.Call("box.space."+spaceName+":create_index", []interface{}{"primary", createIndexTuple})
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	s.Close()
@@ -125,3 +137,159 @@ func TestStorageTarantool_GetNoKey(t *testing.T) {
 		t.Error(err, string(val))
 	}
 }
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageTarantool_StoreBatch(t *testing.T) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			t.Skip(err)
+		}
+	}()
+
+	s := tarantoolTestInit()
+	defer s.Close()
+	s.conn.Insert(TEST_TARANTOOL_SPACE, []interface{}{"2", "old"})
+	errs := s.StoreBatch([][]byte{[]byte("1"), []byte("2"), []byte("1")}, [][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	if len(errs) != 3 || errs[0] != nil || errs[1] != errDuplicate || errs[2] != errDuplicate {
+		t.Error(errs)
+	}
+	for key, expected := range map[string]string{"1": "a", "2": "old"} {
+		val, err := s.Get([]byte(key))
+		if err != nil || string(val) != expected {
+			t.Error(key, err, string(val))
+		}
+	}
+}
+
+//nolint:deadcode,megacheck
+func TestStorageTarantool_Conformance(t *testing.T) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			t.Skip(err)
+		}
+	}()
+
+	s := tarantoolTestInit()
+	defer s.Close()
+	testMutableStorageConformance(t, s)
+}
+
+//nolint:deadcode,megacheck
+func TestStorageTarantool_ExpiringConformance(t *testing.T) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			t.Skip(err)
+		}
+	}()
+
+	s := tarantoolTestInit()
+	defer s.Close()
+	testExpiringStorageConformance(t, s)
+}
+
+//nolint:deadcode,megacheck
+func TestStorageTarantool_ClickConformance(t *testing.T) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			t.Skip(err)
+		}
+	}()
+
+	s := tarantoolTestInit()
+	defer s.Close()
+	testClickStorageConformance(t, s)
+}
+
+//nolint:deadcode,megacheck
+func TestStorageTarantool_DedupConformance(t *testing.T) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			t.Skip(err)
+		}
+	}()
+
+	s := tarantoolTestInit()
+	defer s.Close()
+	testDedupStorageConformance(t, s)
+}
+
+//nolint:deadcode,megacheck
+func TestStorageTarantool_RemoveExpiredBatches(t *testing.T) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			t.Skip(err)
+		}
+	}()
+
+	s := tarantoolTestInit()
+	defer s.Close()
+
+	now := time.Now()
+	count := tarantoolRemoveExpiredLimit*2 + 1
+	for i := 0; i < count; i++ {
+		if err := s.StoreExpiring([]byte("expired-"+strconv.Itoa(i)), []byte("1"), now.Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.StoreExpiring([]byte("alive"), []byte("1"), now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store([]byte("forever"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := s.RemoveExpired(now)
+	if err != nil || removed != count {
+		t.Error(removed, err)
+	}
+	for _, key := range []string{"alive", "forever"} {
+		if _, err = s.Get([]byte(key)); err != nil {
+			t.Error(key, err)
+		}
+	}
+}
+
+//nolint:deadcode,megacheck,errcheck
+func TestStorageTarantool_WithoutStatsSpace(t *testing.T) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			t.Skip(err)
+		}
+	}()
+
+	s := tarantoolTestInit()
+	statsSpace := s.conn.Schema.Spaces[TEST_TARANTOOL_SPACE+tarantoolStatsSpaceSuffix]
+	if _, err := s.conn.Call("box.schema.space.drop", []interface{}{statsSpace.Id}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = NewStorageTarantool(TEST_TARANTOOL_SERVER, TEST_TARANTOOL_USER, TEST_TARANTOOL_PASSWORD, TEST_TARANTOOL_SPACE)
+	defer s.Close()
+	if s.HasStats() {
+		t.Error("stats without stats space")
+	}
+	if err := s.AddClicks([]byte("key"), ClickStats{Count: 1}); err != errNotSupported {
+		t.Error(err)
+	}
+
+	if err := s.StoreExpiring([]byte("key"), []byte("1"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store([]byte("other"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete([]byte("other")); err != nil {
+		t.Error(err)
+	}
+	if removed, err := s.RemoveExpired(time.Now()); err != nil || removed != 1 {
+		t.Error(removed, err)
+	}
+}
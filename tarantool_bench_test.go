@@ -51,3 +51,30 @@ func BenchmarkStorageTarantool_Store(b *testing.B) {
 		}
 	})
 }
+
+//nolint:deadcode,megacheck
+func BenchmarkStorageTarantool_StoreBatch(b *testing.B) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			b.Skip(err)
+		}
+	}()
+	s := tarantoolTestInit()
+	defer s.Close()
+	keys, vals := createBenchData(b.N)
+
+	b.ResetTimer()
+	for len(keys) > 0 {
+		batchSize := benchmarkBatchSize
+		if batchSize > len(keys) {
+			batchSize = len(keys)
+		}
+		for _, err := range s.StoreBatch(keys[:batchSize], vals[:batchSize]) {
+			if err != nil {
+				b.Error(err)
+			}
+		}
+		keys, vals = keys[batchSize:], vals[batchSize:]
+	}
+}